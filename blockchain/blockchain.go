@@ -1,13 +1,11 @@
 package blockchain
 
 import (
-	"context"
 	"fmt"
-	"log/slog"
 	"os"
 	"sync"
+	"time"
 
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/joho/godotenv"
 )
 
@@ -27,11 +25,66 @@ func init() {
 }
 
 type Network struct {
-	Network   string
+	Network string
+	// WsUrl and HttpUrl are the primary endpoints, the first of WsUrls and HttpUrls.
 	WsUrl     string
 	HttpUrl   string
+	WsUrls    []string
+	HttpUrls  []string
 	ChainName string
 	ChainID   int
+
+	NativeSymbol    string
+	WrappedNative   string
+	BlockTime       time.Duration
+	SupportsEIP1559 bool
+
+	// PollInterval and MaxLogRange tune log polling, used instead of
+	// subscriptions when the network has no websocket endpoint. PollInterval
+	// defaults to BlockTime and MaxLogRange, the most blocks asked for in one
+	// eth_getLogs call, to DefaultMaxLogRange.
+	PollInterval time.Duration
+	MaxLogRange  uint64
+}
+
+// DefaultMaxLogRange fits the eth_getLogs block range limit of most providers.
+const DefaultMaxLogRange = 1000
+
+// LogPollInterval is how often logs are polled for when subscriptions are
+// unavailable.
+func (n *Network) LogPollInterval() time.Duration {
+	switch {
+	case n.PollInterval > 0:
+		return n.PollInterval
+	case n.BlockTime > 0:
+		return n.BlockTime
+	default:
+		return time.Second
+	}
+}
+
+// LogRange is the most blocks fetched by one eth_getLogs call.
+func (n *Network) LogRange() uint64 {
+	if n.MaxLogRange > 0 {
+		return n.MaxLogRange
+	}
+	return DefaultMaxLogRange
+}
+
+// normalize keeps the primary endpoints and the endpoint lists in sync.
+func (n *Network) normalize() {
+	if len(n.WsUrls) == 0 && n.WsUrl != "" {
+		n.WsUrls = []string{n.WsUrl}
+	}
+	if len(n.HttpUrls) == 0 && n.HttpUrl != "" {
+		n.HttpUrls = []string{n.HttpUrl}
+	}
+	if len(n.WsUrls) > 0 {
+		n.WsUrl = n.WsUrls[0]
+	}
+	if len(n.HttpUrls) > 0 {
+		n.HttpUrl = n.HttpUrls[0]
+	}
 }
 
 func getChains() map[string]*Network {
@@ -43,48 +96,75 @@ func getChains() map[string]*Network {
 
 		chains = map[string]*Network{
 			"BscMainnet": {
-				Network:   Mainnet,
-				WsUrl:     "wss://bsc-rpc.publicnode.com",
-				HttpUrl:   "https://bsc-rpc.publicnode.com",
-				ChainName: "BSC",
-				ChainID:   56,
+				Network:         Mainnet,
+				WsUrl:           "wss://bsc-rpc.publicnode.com",
+				HttpUrl:         "https://bsc-rpc.publicnode.com",
+				ChainName:       "BSC",
+				ChainID:         56,
+				NativeSymbol:    "BNB",
+				WrappedNative:   "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+				BlockTime:       750 * time.Millisecond,
+				SupportsEIP1559: true,
 			},
 			"BscTestnet": {
-				Network:   Testnet,
-				WsUrl:     "wss://bsc-testnet-rpc.publicnode.com",
-				HttpUrl:   "https://bsc-testnet.bnbchain.org",
-				ChainName: "BSC",
-				ChainID:   97,
+				Network:         Testnet,
+				WsUrl:           "wss://bsc-testnet-rpc.publicnode.com",
+				HttpUrl:         "https://bsc-testnet.bnbchain.org",
+				ChainName:       "BSC",
+				ChainID:         97,
+				NativeSymbol:    "tBNB",
+				WrappedNative:   "0xae13d989daC2f0dEbFf460aC112a837C89BAa7cd",
+				BlockTime:       750 * time.Millisecond,
+				SupportsEIP1559: true,
 			},
 			"BscTestnetInfura": {
-				Network:   Testnet,
-				WsUrl:     "wss://bsc-testnet.infura.io/ws/v3/" + infuraAPIKey,
-				HttpUrl:   "https://bsc-testnet.infura.io/v3/" + infuraAPIKey,
-				ChainName: "BSC",
-				ChainID:   97,
+				Network:         Testnet,
+				WsUrl:           "wss://bsc-testnet.infura.io/ws/v3/" + infuraAPIKey,
+				HttpUrl:         "https://bsc-testnet.infura.io/v3/" + infuraAPIKey,
+				ChainName:       "BSC",
+				ChainID:         97,
+				NativeSymbol:    "tBNB",
+				WrappedNative:   "0xae13d989daC2f0dEbFf460aC112a837C89BAa7cd",
+				BlockTime:       750 * time.Millisecond,
+				SupportsEIP1559: true,
 			},
 			"BscMainnetInfura": {
-				Network:   Mainnet,
-				WsUrl:     "wss://bsc-mainnet.infura.io/ws/v3/" + infuraAPIKey,
-				HttpUrl:   "https://bsc-rpc.publicnode.com",
-				ChainName: "BSC",
-				ChainID:   56,
+				Network:         Mainnet,
+				WsUrl:           "wss://bsc-mainnet.infura.io/ws/v3/" + infuraAPIKey,
+				HttpUrl:         "https://bsc-rpc.publicnode.com",
+				ChainName:       "BSC",
+				ChainID:         56,
+				NativeSymbol:    "BNB",
+				WrappedNative:   "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+				BlockTime:       750 * time.Millisecond,
+				SupportsEIP1559: true,
 			},
 			"EthMainnet": {
-				Network:   Mainnet,
-				WsUrl:     "wss://mainnet.infura.io/ws/v3/" + infuraAPIKey,
-				HttpUrl:   "https://ethereum.publicnode.com",
-				ChainName: "ethereum",
-				ChainID:   1,
+				Network:         Mainnet,
+				WsUrl:           "wss://mainnet.infura.io/ws/v3/" + infuraAPIKey,
+				HttpUrl:         "https://ethereum.publicnode.com",
+				ChainName:       "ethereum",
+				ChainID:         1,
+				NativeSymbol:    "ETH",
+				WrappedNative:   "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+				BlockTime:       12 * time.Second,
+				SupportsEIP1559: true,
 			},
 			"EthSepolia": {
-				Network:   Testnet,
-				WsUrl:     "wss://sepolia.infura.io/ws/v3/" + infuraAPIKey,
-				HttpUrl:   "https://sepolia.infura.io/v3/" + infuraAPIKey,
-				ChainName: "ethereum",
-				ChainID:   11155111,
+				Network:         Testnet,
+				WsUrl:           "wss://sepolia.infura.io/ws/v3/" + infuraAPIKey,
+				HttpUrl:         "https://sepolia.infura.io/v3/" + infuraAPIKey,
+				ChainName:       "ethereum",
+				ChainID:         11155111,
+				NativeSymbol:    "ETH",
+				WrappedNative:   "0xfFf9976782d46CC05630D1f6eBAb18b2324d6B14",
+				BlockTime:       12 * time.Second,
+				SupportsEIP1559: true,
 			},
 		}
+		for _, network := range chains {
+			network.normalize()
+		}
 	})
 	return chains
 }
@@ -96,32 +176,6 @@ func GetChains() map[string]*Network {
 
 var ActiveChain *Network
 
-func Connect(network *Network) *ethclient.Client {
-	if network != nil {
-		ActiveChain = network
-	} else {
-		// Use default chain if none provided
-		ActiveChain = getChains()["BscMainnet"]
-	}
-
-	cl, err := ethclient.DialContext(context.Background(), ActiveChain.WsUrl)
-	if err != nil {
-		slog.Error("Could not connect", "error", err)
-		return nil
-	}
-
-	slog.Info("Connected to chain",
-		slog.Group("chain",
-			"network", ActiveChain.Network,
-			"wsUrl", ActiveChain.WsUrl,
-			"httpUrl", ActiveChain.HttpUrl,
-			"chainName", ActiveChain.ChainName,
-			"chainID", ActiveChain.ChainID,
-		),
-	)
-	return cl
-}
-
 func GetGasPrice() (uint64, error) {
 	return 12, nil
 	// httpClient, _ := ethclient.Dial("https://ethereum.publicnode.com")
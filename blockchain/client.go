@@ -0,0 +1,519 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	healthCheckInterval = 5 * time.Second
+	healthCheckTimeout  = 2 * time.Second
+	// maxHeadLag is how many blocks an endpoint may trail the best head
+	// before it is ranked behind every endpoint that keeps up.
+	maxHeadLag = 3
+	// latencyWeight is the weight of the newest sample in the latency average.
+	latencyWeight = 0.3
+)
+
+// hedgedMethods are latency-sensitive reads sent to the two best endpoints at
+// once, taking whichever answers first. Reads a lagging node answers wrongly
+// rather than slowly are left out: the head, balances, nonces, blocks by
+// number and receipts, which it reports stale or missing. So is transaction
+// submission.
+var hedgedMethods = map[string]bool{
+	"eth_call":                 true,
+	"eth_gasPrice":             true,
+	"eth_maxPriorityFeePerGas": true,
+}
+
+// Endpoint is one RPC provider of the active network and how it has behaved.
+type Endpoint struct {
+	URL       string
+	Websocket bool
+
+	mu        sync.Mutex
+	client    *ethclient.Client
+	head      uint64
+	latency   time.Duration
+	failures  int
+	lastError error
+	checkedAt time.Time
+}
+
+// EndpointHealth is a snapshot of an endpoint's health.
+type EndpointHealth struct {
+	URL       string
+	Websocket bool
+	Head      uint64
+	Latency   time.Duration
+	Failures  int
+	LastError error
+	CheckedAt time.Time
+}
+
+func (e *Endpoint) conn() *ethclient.Client {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.client
+}
+
+func (e *Endpoint) Health() EndpointHealth {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return EndpointHealth{
+		URL:       e.URL,
+		Websocket: e.Websocket,
+		Head:      e.head,
+		Latency:   e.latency,
+		Failures:  e.failures,
+		LastError: e.lastError,
+		CheckedAt: e.checkedAt,
+	}
+}
+
+// record folds the outcome of one request into the endpoint's health.
+func (e *Endpoint) record(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.failures++
+		e.lastError = err
+		return
+	}
+	e.failures = 0
+	e.lastError = nil
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(e.latency))
+	}
+}
+
+func (e *Endpoint) recordHead(head uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.head = head
+	e.checkedAt = time.Now()
+}
+
+// rankEndpoints orders endpoints from healthiest to least healthy: failing
+// endpoints last, then those trailing the best head, then by latency.
+func rankEndpoints(endpoints []*Endpoint) []*Endpoint {
+	health := make(map[*Endpoint]EndpointHealth, len(endpoints))
+	var best uint64
+	for _, endpoint := range endpoints {
+		h := endpoint.Health()
+		health[endpoint] = h
+		best = max(best, h.Head)
+	}
+	penalty := func(h EndpointHealth) int {
+		switch {
+		case h.Failures > 0:
+			return 2
+		case best > h.Head+maxHeadLag:
+			return 1
+		}
+		return 0
+	}
+
+	ranked := append([]*Endpoint(nil), endpoints...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := health[ranked[i]], health[ranked[j]]
+		if penalty(a) != penalty(b) {
+			return penalty(a) < penalty(b)
+		}
+		if a.Failures != b.Failures {
+			return a.Failures < b.Failures
+		}
+		return a.Latency < b.Latency
+	})
+	return ranked
+}
+
+// Client is an ethclient spread over every endpoint of a network. Calls go to
+// the healthiest HTTP endpoint and fail over to the next one, latency
+// sensitive reads are hedged across the two best, and subscriptions are
+// opened on the healthiest websocket endpoint. Endpoints are health checked in
+// the background for head lag, latency and errors.
+type Client struct {
+	*ethclient.Client
+
+	network *Network
+	http    []*Endpoint
+	ws      []*Endpoint
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+// Connect dials every endpoint of network and makes it the active chain. It
+// fails only when no endpoint can be reached.
+func Connect(network *Network) (*Client, error) {
+	if network != nil {
+		ActiveChain = network
+	} else {
+		// Use default chain if none provided
+		ActiveChain = getChains()["BscMainnet"]
+	}
+
+	c := &Client{network: ActiveChain, stop: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	for _, rawURL := range ActiveChain.HttpUrls {
+		client, err := ethclient.DialContext(ctx, rawURL)
+		if err != nil {
+			slog.Warn("Skipping endpoint", "url", redactURL(rawURL), "error", err)
+			continue
+		}
+		c.http = append(c.http, &Endpoint{URL: rawURL, client: client})
+	}
+	for _, rawURL := range ActiveChain.WsUrls {
+		endpoint := &Endpoint{URL: rawURL, Websocket: true}
+		client, err := ethclient.DialContext(ctx, rawURL)
+		if err != nil {
+			endpoint.record(0, err)
+			slog.Warn("Could not connect to websocket endpoint, retrying in the background", "url", redactURL(rawURL), "error", err)
+		}
+		endpoint.client = client
+		c.ws = append(c.ws, endpoint)
+	}
+
+	if len(c.http) > 0 {
+		transport := &failoverTransport{endpoints: c.http, base: http.DefaultTransport}
+		rpcClient, err := rpc.DialOptions(context.Background(), c.http[0].URL,
+			rpc.WithHTTPClient(&http.Client{Transport: transport}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rpc client: %w", err)
+		}
+		c.Client = ethclient.NewClient(rpcClient)
+	} else if ws := c.connectedWebsocket(); ws != nil {
+		// Without HTTP endpoints calls share the first websocket connection
+		// and do not fail over.
+		c.Client = ws.conn()
+	} else {
+		return nil, errors.New("no endpoint of the network could be reached")
+	}
+
+	c.checkHealth()
+	if err := c.verifyReachable(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	go c.monitor()
+
+	slog.Info("Connected to chain",
+		slog.Group("chain",
+			"network", ActiveChain.Network,
+			"chainName", ActiveChain.ChainName,
+			"chainID", ActiveChain.ChainID,
+			"httpEndpoints", len(c.http),
+			"wsEndpoints", len(c.ws),
+		),
+	)
+	return c, nil
+}
+
+func (c *Client) verifyReachable() error {
+	for _, endpoint := range c.Endpoints() {
+		if endpoint.Failures == 0 {
+			return nil
+		}
+	}
+	return errors.New("no endpoint of the network is healthy")
+}
+
+func (c *Client) connectedWebsocket() *Endpoint {
+	for _, endpoint := range c.ws {
+		if endpoint.conn() != nil {
+			return endpoint
+		}
+	}
+	return nil
+}
+
+func (c *Client) monitor() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.checkHealth()
+		}
+	}
+}
+
+// checkHealth reads every endpoint's head and chain id, re-dialling websocket
+// endpoints that are not connected.
+func (c *Client) checkHealth() {
+	var wg sync.WaitGroup
+	for _, endpoint := range append(append([]*Endpoint(nil), c.http...), c.ws...) {
+		wg.Add(1)
+		go func(endpoint *Endpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+			defer cancel()
+
+			client := endpoint.conn()
+			if client == nil {
+				var err error
+				if client, err = ethclient.DialContext(ctx, endpoint.URL); err != nil {
+					endpoint.record(0, err)
+					return
+				}
+				endpoint.mu.Lock()
+				endpoint.client = client
+				endpoint.mu.Unlock()
+			}
+
+			start := time.Now()
+			head, err := client.BlockNumber(ctx)
+			if err == nil {
+				var chainID *big.Int
+				if chainID, err = client.ChainID(ctx); err == nil && chainID.Int64() != int64(c.network.ChainID) {
+					err = fmt.Errorf("endpoint serves chain %s instead of %d", chainID, c.network.ChainID)
+				}
+			}
+			endpoint.record(time.Since(start), err)
+			if err != nil {
+				slog.Warn("Endpoint health check failed", "url", redactURL(endpoint.URL), "error", err)
+				return
+			}
+			endpoint.recordHead(head)
+		}(endpoint)
+	}
+	wg.Wait()
+}
+
+// Endpoints returns the health of every endpoint, healthiest first.
+func (c *Client) Endpoints() []EndpointHealth {
+	var health []EndpointHealth
+	for _, endpoint := range rankEndpoints(append(append([]*Endpoint(nil), c.http...), c.ws...)) {
+		health = append(health, endpoint.Health())
+	}
+	return health
+}
+
+// ErrNoWebsocket is returned by subscriptions when the network has no
+// websocket endpoint; callers poll over HTTP instead.
+var ErrNoWebsocket = errors.New("network has no websocket endpoint")
+
+// SubscribeFilterLogs subscribes on the healthiest connected websocket
+// endpoint, trying the next one when it refuses. Callers resubscribe when the
+// subscription fails, which moves them to whichever endpoint is best then.
+func (c *Client) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	if len(c.ws) == 0 {
+		return nil, ErrNoWebsocket
+	}
+	var errs []error
+	for _, endpoint := range rankEndpoints(c.ws) {
+		client := endpoint.conn()
+		if client == nil {
+			continue
+		}
+		sub, err := client.SubscribeFilterLogs(ctx, q, ch)
+		if err == nil {
+			return sub, nil
+		}
+		endpoint.record(0, err)
+		errs = append(errs, fmt.Errorf("%s: %w", redactURL(endpoint.URL), err))
+	}
+	return nil, fmt.Errorf("no websocket endpoint accepted the subscription: %w", errors.Join(errs...))
+}
+
+// SubscribeNewHead subscribes to new heads on the healthiest connected
+// websocket endpoint, like SubscribeFilterLogs.
+func (c *Client) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	if len(c.ws) == 0 {
+		return nil, ErrNoWebsocket
+	}
+	var errs []error
+	for _, endpoint := range rankEndpoints(c.ws) {
+		client := endpoint.conn()
+		if client == nil {
+			continue
+		}
+		sub, err := client.SubscribeNewHead(ctx, ch)
+		if err == nil {
+			return sub, nil
+		}
+		endpoint.record(0, err)
+		errs = append(errs, fmt.Errorf("%s: %w", redactURL(endpoint.URL), err))
+	}
+	return nil, fmt.Errorf("no websocket endpoint accepted the subscription: %w", errors.Join(errs...))
+}
+
+// Close stops the health checks and closes every connection.
+func (c *Client) Close() {
+	c.stopped.Do(func() {
+		close(c.stop)
+		if len(c.http) > 0 {
+			c.Client.Close()
+		}
+		for _, endpoint := range append(append([]*Endpoint(nil), c.http...), c.ws...) {
+			if client := endpoint.conn(); client != nil {
+				client.Close()
+			}
+		}
+	})
+}
+
+// failoverTransport sends JSON-RPC over HTTP to the healthiest endpoint,
+// retrying the next one on transport errors, rate limits and server errors.
+type failoverTransport struct {
+	endpoints []*Endpoint
+	base      http.RoundTripper
+}
+
+// errEndpointStatus marks a response an endpoint should be skipped for.
+var errEndpointStatus = errors.New("endpoint returned an error status")
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	ranked := rankEndpoints(t.endpoints)
+	if len(ranked) > 1 && hedgedMethods[rpcMethod(body)] {
+		return t.hedge(req, body, ranked[:2])
+	}
+
+	var errs []error
+	for _, endpoint := range ranked {
+		resp, err := t.send(req.Context(), req, body, endpoint)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, err)
+		if req.Context().Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// hedge sends the request to every endpoint at once and returns the first
+// good response, cancelling the others.
+func (t *failoverTransport) hedge(req *http.Request, body []byte, endpoints []*Endpoint) (*http.Response, error) {
+	type result struct {
+		index int
+		resp  *http.Response
+		err   error
+	}
+	results := make(chan result, len(endpoints))
+	cancels := make([]context.CancelFunc, len(endpoints))
+	for i, endpoint := range endpoints {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels[i] = cancel
+		go func(i int, endpoint *Endpoint) {
+			resp, err := t.send(ctx, req, body, endpoint)
+			results <- result{index: i, resp: resp, err: err}
+		}(i, endpoint)
+	}
+
+	var errs []error
+	for received := 1; received <= len(endpoints); received++ {
+		r := <-results
+		if r.err != nil {
+			cancels[r.index]()
+			errs = append(errs, r.err)
+			continue
+		}
+		for i, cancel := range cancels {
+			if i != r.index {
+				cancel()
+			}
+		}
+		go func(remaining int) {
+			for ; remaining > 0; remaining-- {
+				if late := <-results; late.err == nil {
+					late.resp.Body.Close()
+				}
+			}
+		}(len(endpoints) - received)
+		// The winner's request stays open until its body has been read.
+		r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: cancels[r.index]}
+		return r.resp, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+func (t *failoverTransport) send(ctx context.Context, req *http.Request, body []byte, endpoint *Endpoint) (*http.Response, error) {
+	target, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return nil, err
+	}
+	attempt := req.Clone(ctx)
+	attempt.URL = target
+	attempt.Host = target.Host
+	attempt.Body = io.NopCloser(bytes.NewReader(body))
+	attempt.ContentLength = int64(len(body))
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(attempt)
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError) {
+		resp.Body.Close()
+		err = fmt.Errorf("%w %d", errEndpointStatus, resp.StatusCode)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			endpoint.record(0, err)
+			slog.Warn("Endpoint failed, failing over", "url", redactURL(endpoint.URL), "error", err)
+		}
+		return nil, fmt.Errorf("%s: %w", redactURL(endpoint.URL), err)
+	}
+	endpoint.record(time.Since(start), nil)
+	return resp, nil
+}
+
+// rpcMethod returns the method of a single JSON-RPC request, or "" for a batch.
+func rpcMethod(body []byte) string {
+	var msg struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return ""
+	}
+	return msg.Method
+}
+
+// redactURL drops the path and query of an endpoint URL, where providers put
+// API keys, before it is logged.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRankEndpoints_PrefersHealthyUpToDateAndFast(t *testing.T) {
+	// Arrange
+	failing := &Endpoint{URL: "failing", head: 100, latency: time.Millisecond, failures: 1}
+	lagging := &Endpoint{URL: "lagging", head: 90, latency: time.Millisecond}
+	slow := &Endpoint{URL: "slow", head: 100, latency: 300 * time.Millisecond}
+	fast := &Endpoint{URL: "fast", head: 99, latency: 20 * time.Millisecond}
+
+	// Act
+	ranked := rankEndpoints([]*Endpoint{failing, lagging, slow, fast})
+
+	// Assert
+	expected := []string{"fast", "slow", "lagging", "failing"}
+	for i, endpoint := range ranked {
+		if endpoint.URL != expected[i] {
+			t.Errorf("Expected %s at rank %d, got %s", expected[i], i, endpoint.URL)
+		}
+	}
+}
+
+func rpcServer(delay time.Duration, status int, result string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(status)
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":"`+result+`"}`)
+	}))
+}
+
+func roundTrip(t *testing.T, transport *failoverTransport, method string) (string, error) {
+	t.Helper()
+	body := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":[]}`
+	req, _ := http.NewRequest(http.MethodPost, "http://placeholder", strings.NewReader(body))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+func TestFailoverTransport_FailsOverOnServerError(t *testing.T) {
+	// Arrange
+	broken := rpcServer(0, http.StatusBadGateway, "broken")
+	defer broken.Close()
+	working := rpcServer(0, http.StatusOK, "working")
+	defer working.Close()
+	brokenEndpoint := &Endpoint{URL: broken.URL}
+	transport := &failoverTransport{
+		endpoints: []*Endpoint{brokenEndpoint, {URL: working.URL, latency: time.Second}},
+		base:      http.DefaultTransport,
+	}
+
+	// Act
+	body, err := roundTrip(t, transport, "eth_sendRawTransaction")
+
+	// Assert
+	if err != nil || !strings.Contains(body, "working") {
+		t.Fatalf("Expected the working endpoint to answer, got %q (%v)", body, err)
+	}
+	if health := brokenEndpoint.Health(); health.Failures != 1 || !errors.Is(health.LastError, errEndpointStatus) {
+		t.Errorf("Expected the broken endpoint to be marked failing, got %+v", health)
+	}
+	if ranked := rankEndpoints(transport.endpoints); ranked[0] == brokenEndpoint {
+		t.Errorf("Expected the broken endpoint to be ranked last")
+	}
+}
+
+func TestFailoverTransport_HedgesReads(t *testing.T) {
+	// Arrange
+	slow := rpcServer(500*time.Millisecond, http.StatusOK, "slow")
+	defer slow.Close()
+	fast := rpcServer(0, http.StatusOK, "fast")
+	defer fast.Close()
+	transport := &failoverTransport{
+		// The slow endpoint is ranked first, so only hedging reaches the fast one in time.
+		endpoints: []*Endpoint{{URL: slow.URL, latency: time.Millisecond}, {URL: fast.URL, latency: time.Second}},
+		base:      http.DefaultTransport,
+	}
+
+	// Act
+	start := time.Now()
+	body, err := roundTrip(t, transport, "eth_call")
+
+	// Assert
+	if err != nil || !strings.Contains(body, "fast") {
+		t.Fatalf("Expected the fast endpoint to answer, got %q (%v)", body, err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("Expected the hedged read to return before the slow endpoint, took %s", elapsed)
+	}
+}
+
+func TestFailoverTransport_DoesNotHedgeStateReads(t *testing.T) {
+	// Arrange
+	best := rpcServer(200*time.Millisecond, http.StatusOK, "best")
+	defer best.Close()
+	lagging := rpcServer(0, http.StatusOK, "lagging")
+	defer lagging.Close()
+	transport := &failoverTransport{
+		endpoints: []*Endpoint{{URL: best.URL, latency: time.Millisecond}, {URL: lagging.URL, latency: time.Second}},
+		base:      http.DefaultTransport,
+	}
+
+	for _, method := range []string{"eth_blockNumber", "eth_getBalance", "eth_getTransactionReceipt"} {
+		// Act
+		body, err := roundTrip(t, transport, method)
+
+		// Assert
+		if err != nil || !strings.Contains(body, "best") {
+			t.Errorf("Expected %s to be answered by the best endpoint only, got %q (%v)", method, body, err)
+		}
+	}
+}
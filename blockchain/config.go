@@ -0,0 +1,183 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// networkFile is the on-disk description of a network. String values may
+// reference environment variables as ${NAME} so secrets stay out of the file.
+//
+//	{
+//	  "BscMainnet": {
+//	    "network": "mainnet",
+//	    "chainName": "BSC",
+//	    "chainId": 56,
+//	    "wsUrls": ["wss://bsc-mainnet.infura.io/ws/v3/${INFURA_API_KEY}"],
+//	    "httpUrls": ["https://bsc-rpc.publicnode.com"],
+//	    "nativeSymbol": "BNB",
+//	    "wrappedNative": "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+//	    "blockTime": "750ms",
+//	    "supportsEIP1559": true,
+//	    "pollInterval": "1s",
+//	    "maxLogRange": 1000
+//	  }
+//	}
+type networkFile struct {
+	Network         string   `json:"network"`
+	ChainName       string   `json:"chainName"`
+	ChainID         int      `json:"chainId"`
+	WsUrls          []string `json:"wsUrls"`
+	HttpUrls        []string `json:"httpUrls"`
+	NativeSymbol    string   `json:"nativeSymbol"`
+	WrappedNative   string   `json:"wrappedNative"`
+	BlockTime       string   `json:"blockTime"`
+	SupportsEIP1559 bool     `json:"supportsEIP1559"`
+	PollInterval    string   `json:"pollInterval"`
+	MaxLogRange     uint64   `json:"maxLogRange"`
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadNetworks replaces the built-in networks with the ones defined in the
+// JSON file at path. It must be called before GetChains or Connect.
+func LoadNetworks(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read network config: %w", err)
+	}
+
+	loaded, err := ParseNetworks(data, os.LookupEnv)
+	if err != nil {
+		return fmt.Errorf("invalid network config %s: %w", path, err)
+	}
+
+	// Mark the built-in networks as initialized so they never overwrite the file.
+	chainsOnce.Do(func() {})
+	chains = loaded
+
+	slog.Info("Loaded network config", "path", path, "networks", len(loaded))
+	return nil
+}
+
+// ParseNetworks decodes and validates a network config, resolving ${NAME}
+// references through lookupEnv. Unset variables are reported as errors
+// rather than silently producing broken URLs.
+func ParseNetworks(data []byte, lookupEnv func(string) (string, bool)) (map[string]*Network, error) {
+	var file map[string]*networkFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode: %w", err)
+	}
+
+	var errs []error
+	networks := make(map[string]*Network, len(file))
+	for name, entry := range file {
+		network, err := entry.toNetwork(lookupEnv)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		networks[name] = network
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return networks, nil
+}
+
+func (f *networkFile) toNetwork(lookupEnv func(string) (string, bool)) (*Network, error) {
+	if f == nil {
+		return nil, errors.New("network is empty")
+	}
+
+	var errs []error
+	expand := func(field, value string) string {
+		return envReference.ReplaceAllStringFunc(value, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			resolved, ok := lookupEnv(name)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: environment variable %s is not set", field, name))
+			}
+			return resolved
+		})
+	}
+
+	network := &Network{
+		Network:         f.Network,
+		ChainName:       f.ChainName,
+		ChainID:         f.ChainID,
+		NativeSymbol:    f.NativeSymbol,
+		WrappedNative:   expand("wrappedNative", f.WrappedNative),
+		SupportsEIP1559: f.SupportsEIP1559,
+		MaxLogRange:     f.MaxLogRange,
+	}
+	for i, endpoint := range f.WsUrls {
+		network.WsUrls = append(network.WsUrls, expand(fmt.Sprintf("wsUrls[%d]", i), endpoint))
+	}
+	for i, endpoint := range f.HttpUrls {
+		network.HttpUrls = append(network.HttpUrls, expand(fmt.Sprintf("httpUrls[%d]", i), endpoint))
+	}
+
+	if network.Network != Mainnet && network.Network != Testnet {
+		errs = append(errs, fmt.Errorf("network must be %q or %q", Mainnet, Testnet))
+	}
+	if network.ChainName == "" {
+		errs = append(errs, errors.New("chainName is required"))
+	}
+	if network.ChainID <= 0 {
+		errs = append(errs, errors.New("chainId must be positive"))
+	}
+	if len(network.WsUrls) == 0 && len(network.HttpUrls) == 0 {
+		errs = append(errs, errors.New("at least one wsUrls or httpUrls endpoint is required"))
+	}
+	errs = append(errs, validateEndpoints("wsUrls", network.WsUrls, "ws", "wss")...)
+	errs = append(errs, validateEndpoints("httpUrls", network.HttpUrls, "http", "https")...)
+	if network.WrappedNative != "" && !common.IsHexAddress(network.WrappedNative) {
+		errs = append(errs, fmt.Errorf("wrappedNative: %q is not an address", network.WrappedNative))
+	}
+	if f.BlockTime != "" {
+		blockTime, err := time.ParseDuration(f.BlockTime)
+		if err != nil || blockTime <= 0 {
+			errs = append(errs, fmt.Errorf("blockTime: %q is not a positive duration", f.BlockTime))
+		}
+		network.BlockTime = blockTime
+	}
+	if f.PollInterval != "" {
+		pollInterval, err := time.ParseDuration(f.PollInterval)
+		if err != nil || pollInterval <= 0 {
+			errs = append(errs, fmt.Errorf("pollInterval: %q is not a positive duration", f.PollInterval))
+		}
+		network.PollInterval = pollInterval
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	network.normalize()
+	return network, nil
+}
+
+func validateEndpoints(field string, endpoints []string, schemes ...string) []error {
+	var errs []error
+	for i, endpoint := range endpoints {
+		parsed, err := url.Parse(endpoint)
+		if err != nil || parsed.Host == "" || !slices.Contains(schemes, parsed.Scheme) {
+			// The endpoint may embed a secret, so only the scheme is reported.
+			errs = append(errs, fmt.Errorf("%s[%d]: must be a %v url", field, i, schemes))
+		}
+	}
+	return errs
+}
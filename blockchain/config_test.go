@@ -0,0 +1,72 @@
+package blockchain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNetworks_ExampleFile(t *testing.T) {
+	// Arrange
+	data, err := os.ReadFile(filepath.Join("..", "networks.example.json"))
+	if err != nil {
+		t.Fatalf("Failed to read example config: %v", err)
+	}
+	env := func(name string) (string, bool) {
+		return map[string]string{"INFURA_API_KEY": "secret"}[name], name == "INFURA_API_KEY"
+	}
+
+	// Act
+	networks, err := ParseNetworks(data, env)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected example config to be valid, got %v", err)
+	}
+	bsc := networks["BscMainnet"]
+	if bsc.WsUrl != "wss://bsc-rpc.publicnode.com" || len(bsc.WsUrls) != 2 {
+		t.Errorf("Expected primary and fallback websocket endpoints, got %v", bsc.WsUrls)
+	}
+	if bsc.WsUrls[1] != "wss://bsc-mainnet.infura.io/ws/v3/secret" {
+		t.Errorf("Expected INFURA_API_KEY to be interpolated, got %s", bsc.WsUrls[1])
+	}
+	if bsc.BlockTime != 750*time.Millisecond || bsc.NativeSymbol != "BNB" || !bsc.SupportsEIP1559 {
+		t.Errorf("Expected chain metadata to be loaded, got %+v", bsc)
+	}
+}
+
+func TestParseNetworks_MissingEnvironmentVariable(t *testing.T) {
+	// Arrange
+	data := []byte(`{"EthSepolia": {"network": "testnet", "chainName": "ethereum", "chainId": 11155111,
+		"wsUrls": ["wss://sepolia.infura.io/ws/v3/${INFURA_API_KEY}"]}}`)
+	noEnv := func(string) (string, bool) { return "", false }
+
+	// Act
+	_, err := ParseNetworks(data, noEnv)
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "INFURA_API_KEY is not set") {
+		t.Errorf("Expected missing variable error, got %v", err)
+	}
+}
+
+func TestParseNetworks_InvalidEntry(t *testing.T) {
+	// Arrange
+	data := []byte(`{"Broken": {"network": "devnet", "chainId": 0, "wsUrls": ["https://wrong-scheme"], "blockTime": "soon", "pollInterval": "-1s"}}`)
+	noEnv := func(string) (string, bool) { return "", false }
+
+	// Act
+	_, err := ParseNetworks(data, noEnv)
+
+	// Assert
+	if err == nil {
+		t.Fatal("Expected config to be rejected")
+	}
+	for _, want := range []string{"network must be", "chainName", "chainId", "wsUrls[0]", "blockTime", "pollInterval"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %v", want, err)
+		}
+	}
+}
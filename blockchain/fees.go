@@ -0,0 +1,37 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/sagarkarki99/arbitrator/constants"
+)
+
+// SetFees prices a transaction for the network. Networks supporting EIP-1559
+// get a dynamic fee transaction capped at constants.GasFeeCap and
+// constants.GasTipCap; the others get a legacy transaction at the gas price
+// the node suggests.
+func (c *Client) SetFees(ctx context.Context, opts *bind.TransactOpts) error {
+	if c.network == nil || c.network.SupportsEIP1559 {
+		opts.GasFeeCap = constants.GasFeeCap
+		opts.GasTipCap = constants.GasTipCap
+		return nil
+	}
+	gasPrice, err := c.SuggestGasPrice(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to suggest gas price: %w", err)
+	}
+	opts.GasPrice = gasPrice
+	opts.GasFeeCap = nil
+	opts.GasTipCap = nil
+	return nil
+}
+
+// NativeSymbol returns the symbol of the network's native coin.
+func (c *Client) NativeSymbol() string {
+	if c.network == nil {
+		return ""
+	}
+	return c.network.NativeSymbol
+}
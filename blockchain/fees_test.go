@@ -0,0 +1,61 @@
+package blockchain
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/sagarkarki99/arbitrator/constants"
+)
+
+func TestSetFees_DynamicFeeOnEIP1559Networks(t *testing.T) {
+	// Arrange
+	c := &Client{network: &Network{SupportsEIP1559: true}}
+	opts := &bind.TransactOpts{}
+
+	// Act
+	err := c.SetFees(context.Background(), opts)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if opts.GasFeeCap.Cmp(constants.GasFeeCap) != 0 || opts.GasTipCap.Cmp(constants.GasTipCap) != 0 {
+		t.Errorf("Expected fee caps %v/%v, got %v/%v", constants.GasFeeCap, constants.GasTipCap, opts.GasFeeCap, opts.GasTipCap)
+	}
+	if opts.GasPrice != nil {
+		t.Errorf("Expected no gas price, got %v", opts.GasPrice)
+	}
+}
+
+func TestSetFees_LegacyGasPriceWithoutEIP1559(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":"0x12a05f200"}`)
+	}))
+	defer server.Close()
+	rpcClient, err := ethclient.Dial(server.URL)
+	if err != nil {
+		t.Fatalf("Expected to dial the test server, got %v", err)
+	}
+	c := &Client{Client: rpcClient, network: &Network{SupportsEIP1559: false}}
+	opts := &bind.TransactOpts{}
+
+	// Act
+	err = c.SetFees(context.Background(), opts)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if opts.GasPrice == nil || opts.GasPrice.Int64() != 5_000_000_000 {
+		t.Errorf("Expected gas price 5000000000, got %v", opts.GasPrice)
+	}
+	if opts.GasFeeCap != nil || opts.GasTipCap != nil {
+		t.Errorf("Expected no fee caps, got %v/%v", opts.GasFeeCap, opts.GasTipCap)
+	}
+}
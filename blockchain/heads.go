@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Resubscription backoff bounds of WatchHeads.
+var (
+	minHeadResubscribeDelay = 500 * time.Millisecond
+	maxHeadResubscribeDelay = 30 * time.Second
+)
+
+// After headSubscribeFailures failed subscriptions in a row, WatchHeads polls
+// for headWebsocketRetry before subscribing again.
+var (
+	headSubscribeFailures = 3
+	headWebsocketRetry    = time.Minute
+)
+
+// WatchHeads sends the number of each new head block until ctx is cancelled,
+// then closes the channel. Numbers only increase, and a slow reader gets the
+// latest head only. Without a websocket the heads are polled for.
+func (c *Client) WatchHeads(ctx context.Context) <-chan uint64 {
+	heads := make(chan uint64, 1)
+	var last uint64
+	emit := func(number uint64) {
+		if number <= last {
+			return
+		}
+		last = number
+		select {
+		case heads <- number:
+		default:
+			// Replace the head the reader has not taken yet.
+			select {
+			case <-heads:
+			default:
+			}
+			heads <- number
+		}
+	}
+
+	go func() {
+		defer close(heads)
+		delay := minHeadResubscribeDelay
+		failures := 0
+		for {
+			established, err := c.subscribeHeads(ctx, emit)
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, ErrNoWebsocket) {
+				c.pollHeads(ctx, emit)
+				return
+			}
+			if established {
+				delay = minHeadResubscribeDelay
+				failures = 0
+			} else if failures++; failures >= headSubscribeFailures {
+				slog.Warn("Head subscription keeps failing, polling until the websocket is retried", "failures", failures, "retryIn", headWebsocketRetry)
+				pollCtx, cancel := context.WithTimeout(ctx, headWebsocketRetry)
+				c.pollHeads(pollCtx, emit)
+				cancel()
+				if ctx.Err() != nil {
+					return
+				}
+				delay = minHeadResubscribeDelay
+				failures = 0
+				continue
+			}
+			slog.Error("Head subscription failed, resubscribing", "error", err, "delay", delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxHeadResubscribeDelay)
+		}
+	}()
+	return heads
+}
+
+// subscribeHeads emits heads until the subscription fails or ctx is
+// cancelled, reporting whether the subscription was established at all.
+func (c *Client) subscribeHeads(ctx context.Context, emit func(uint64)) (bool, error) {
+	headers := make(chan *types.Header)
+	sub, err := c.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		return false, err
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case err := <-sub.Err():
+			return true, err
+		case header := <-headers:
+			emit(header.Number.Uint64())
+		}
+	}
+}
+
+// pollHeads reads the head block every poll interval of the network until ctx
+// is cancelled.
+func (c *Client) pollHeads(ctx context.Context, emit func(uint64)) {
+	interval := c.network.LogPollInterval()
+	slog.Info("Polling new heads", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		number, err := c.BlockNumber(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to read head block", "error", err)
+		} else if err == nil {
+			emit(number)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
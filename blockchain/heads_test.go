@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+func TestWatchHeads_PollsWithoutWebsocket(t *testing.T) {
+	// Arrange
+	var head atomic.Uint64
+	head.Store(99)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, head.Add(1)))
+	}))
+	defer server.Close()
+	rpcClient, err := ethclient.Dial(server.URL)
+	if err != nil {
+		t.Fatalf("Expected to dial the test server, got %v", err)
+	}
+	c := &Client{Client: rpcClient, network: &Network{PollInterval: time.Millisecond}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Act
+	heads := c.WatchHeads(ctx)
+
+	// Assert
+	last := uint64(0)
+	for range 3 {
+		select {
+		case number := <-heads:
+			if number <= last || number < 100 {
+				t.Fatalf("Expected increasing heads from 100, got %d after %d", number, last)
+			}
+			last = number
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for a head after %d", last)
+		}
+	}
+	cancel()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case _, open := <-heads:
+			if !open {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("Expected the heads channel to close after cancellation")
+		}
+	}
+}
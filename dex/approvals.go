@@ -0,0 +1,62 @@
+package dex
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TokenApproval is an allowance a dex adapter needs before it can swap: the
+// spender pulls Token from the trading account.
+type TokenApproval struct {
+	Dex     DexApp
+	Symbol  string
+	Token   common.Address
+	Spender common.Address
+}
+
+// RequiredApprovals lists the token/spender pairs every dex trading symbol on
+// the active network needs. Both adapters swap through their dex's router,
+// which is the spender; V3 pools are paid in the router's swap callback and
+// never pull tokens themselves.
+func RequiredApprovals(symbol string) ([]TokenApproval, error) {
+	networkMap, err := activeNetworkPools()
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make([]DexApp, 0, len(networkMap))
+	for app := range networkMap {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i] < apps[j] })
+
+	var approvals []TokenApproval
+	for _, app := range apps {
+		config, exists := networkMap[app][symbol]
+		if !exists {
+			continue
+		}
+		if config.Token0Contract == "" || config.Token1Contract == "" {
+			return nil, fmt.Errorf("token contracts of %s on %s are unknown, run ValidatePoolConfigs first", symbol, app)
+		}
+
+		spender, err := routerFor(app)
+		if err != nil {
+			return nil, err
+		}
+		for _, token := range []string{config.Token0Contract, config.Token1Contract} {
+			approvals = append(approvals, TokenApproval{
+				Dex:     app,
+				Symbol:  symbol,
+				Token:   common.HexToAddress(token),
+				Spender: common.HexToAddress(spender),
+			})
+		}
+	}
+	if len(approvals) == 0 {
+		return nil, fmt.Errorf("no pools configured for %s", symbol)
+	}
+	return approvals, nil
+}
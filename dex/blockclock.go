@@ -0,0 +1,62 @@
+package dex
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockClockSize is how many recent block timestamps are kept.
+const blockClockSize = 256
+
+// headerReader reads block headers; *blockchain.Client implements it.
+type headerReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// blockClock caches block timestamps so that every event of a block costs a
+// single header lookup.
+type blockClock struct {
+	cl headerReader
+
+	mu    sync.Mutex
+	times map[uint64]time.Time
+}
+
+func newBlockClock(cl headerReader) *blockClock {
+	return &blockClock{cl: cl, times: make(map[uint64]time.Time)}
+}
+
+// timestamp returns the time of block, or the zero time when its header
+// cannot be read.
+func (c *blockClock) timestamp(ctx context.Context, block uint64) time.Time {
+	c.mu.Lock()
+	cached, ok := c.times[block]
+	c.mu.Unlock()
+	if ok {
+		return cached
+	}
+
+	header, err := c.cl.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+	if err != nil {
+		slog.Warn("Failed to read block timestamp", "block", block, "error", err)
+		return time.Time{}
+	}
+	timestamp := time.Unix(int64(header.Time), 0)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.times[block] = timestamp
+	if len(c.times) > blockClockSize {
+		for cachedBlock := range c.times {
+			if cachedBlock+blockClockSize < block {
+				delete(c.times, cachedBlock)
+			}
+		}
+	}
+	return timestamp
+}
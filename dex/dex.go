@@ -32,14 +32,67 @@ package dex
 //    - Execute swap and return transaction hash
 
 import (
+	"context"
+	"errors"
+	"math"
 	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sagarkarki99/arbitrator/contracts"
 )
 
 type Dex interface {
-	GetPrice(symbol string) (<-chan *Price, error)
-	GetPoolFee() float64
-	Buy(amount float64, symbol string) (string, error)
-	Sell(amount float64, symbol string) (string, error)
+	// GetPrice subscribes to the prices of symbol's pool until the
+	// subscription is unsubscribed or ctx is cancelled. Subscribers of the
+	// same pool share one watch of it and each get every price.
+	GetPrice(ctx context.Context, symbol string) (*PriceSubscription, error)
+	// PriceAt reads the pool's price and liquidity as of block.
+	PriceAt(ctx context.Context, symbol string, block uint64) (*Price, error)
+	// GetPoolFee returns the fee of the symbol's pool as a fraction (0.003 = 0.3%).
+	GetPoolFee(symbol string) float64
+	// Buy and Sell swap an exact input amount from the account from, which
+	// signs the swap and receives its output. slippage is the tolerated
+	// fraction (e.g. 0.001 for 0.1%) used to derive the minimum output and
+	// the sqrtPriceX96 limit enforced by the swap.
+	Buy(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*SwapResult, error)
+	Sell(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*SwapResult, error)
+
+	// SimulateBuy and SimulateSell run the exact calldata Buy and Sell would
+	// send from the account from through eth_call against the pending block
+	// without broadcasting it.
+	SimulateBuy(ctx context.Context, from common.Address, amount float64, symbol string) (*SwapSimulation, error)
+	SimulateSell(ctx context.Context, from common.Address, amount float64, symbol string) (*SwapSimulation, error)
+}
+
+// SwapSimulation is the outcome of a swap executed through eth_call.
+// A reverted call is not an error: Reverted is set and RevertReason holds
+// the decoded reason (or the raw node message when it cannot be decoded).
+type SwapSimulation struct {
+	Pool       string
+	Symbol     string
+	ZeroForOne bool
+	AmountIn   *big.Int
+	AmountOut  *big.Int
+	// AmountOutReadable is AmountOut scaled down by the output token decimals.
+	AmountOutReadable float64
+	Reverted          bool
+	RevertReason      string
+}
+
+// Approver makes sure the adapters' spenders may pull owner's tokens of
+// symbol, sending approvals where needed.
+type Approver interface {
+	EnsureApprovals(ctx context.Context, owner common.Address, symbol string) error
+}
+
+// Permitter is implemented by adapters that can authorise their spender with
+// an EIP-2612 permit inside the swap transaction, so token needs no separate
+// approval.
+type Permitter interface {
+	SupportsPermit(ctx context.Context, token common.Address) bool
 }
 
 type DexApp string
@@ -50,10 +103,149 @@ var (
 )
 
 var (
-	UniswapRouter     = "0x3bFA4769FB09eefC5a80d6E87c3B9C650f7Ae48E"
-	PancakeswapRouter = ""
+	UniswapRouter = "0x3bFA4769FB09eefC5a80d6E87c3B9C650f7Ae48E"
+	// PancakeSwap V3 SmartRouter, deployed at the same address on BSC and Ethereum
+	PancakeswapRouter = "0x13f4EA83D0bd40E75C8222255bc855a974568Dd4"
 )
 
+// SwapResult describes a submitted swap and the protections it was sent with.
+type SwapResult struct {
+	Hash              string
+	AmountIn          *big.Int
+	ExpectedAmountOut *big.Int
+	AmountOutMinimum  *big.Int
+	// AmountOutMinimumReadable is AmountOutMinimum scaled down by the output
+	// token decimals: the least the swap pays out if it succeeds.
+	AmountOutMinimumReadable float64
+	SqrtPriceLimitX96        *big.Int
+}
+
+// Bounds of sqrtPriceX96 accepted by V3 pools (TickMath.MIN_SQRT_RATIO and
+// TickMath.MAX_SQRT_RATIO). A price limit must lie strictly between them.
+var (
+	minSqrtRatio, _ = new(big.Int).SetString("4295128739", 10)
+	maxSqrtRatio, _ = new(big.Int).SetString("1461446703485210103287273052203988938313497659660590112342", 10)
+)
+
+// minimumAmountOut applies slippage to an expected output amount.
+// Slippage is applied in parts per million to keep the result exact.
+func minimumAmountOut(expected *big.Int, slippage float64) *big.Int {
+	keepPpm := 1_000_000 - int64(math.Round(slippage*1_000_000))
+	if keepPpm <= 0 {
+		return big.NewInt(0)
+	}
+	minimum := new(big.Int).Mul(expected, big.NewInt(keepPpm))
+	return minimum.Quo(minimum, big.NewInt(1_000_000))
+}
+
+// sqrtPriceLimit returns the sqrtPriceX96 the swap may move the pool to
+// before it stops. Selling token0 (zeroForOne) pushes the price down, so the
+// limit sits below the current price; buying token0 pushes it up.
+// Price scales with the square of sqrtPriceX96, hence the square root.
+func sqrtPriceLimit(sqrtPriceX96 *big.Int, slippage float64, zeroForOne bool) *big.Int {
+	factor := 1 + slippage
+	if zeroForOne {
+		factor = 1 - slippage
+	}
+	if factor < 0 {
+		factor = 0
+	}
+
+	limitFloat := new(big.Float).Mul(new(big.Float).SetInt(sqrtPriceX96), big.NewFloat(math.Sqrt(factor)))
+	limit, _ := limitFloat.Int(nil)
+
+	lowest := new(big.Int).Add(minSqrtRatio, big.NewInt(1))
+	highest := new(big.Int).Sub(maxSqrtRatio, big.NewInt(1))
+	if limit.Cmp(lowest) < 0 {
+		return lowest
+	}
+	if limit.Cmp(highest) > 0 {
+		return highest
+	}
+	return limit
+}
+
+// exactInputSingleParams builds the router parameters shared by the adapters
+// performSwap and simulateSwap so that the simulated calldata is exactly what
+// gets sent. defaultFeeTier is used while the pool's fee is unknown.
+func exactInputSingleParams(config *PoolConfig, defaultFeeTier uint32, amount float64, zeroForOne bool, recipient common.Address, amountOutMinimum, sqrtPriceLimitX96 *big.Int) contracts.IV3SwapRouterExactInputSingleParams {
+	var decimals int
+	var tokenIn, tokenOut common.Address
+	if zeroForOne {
+		// Selling token0 for token1
+		decimals = config.Token0Decimals
+		tokenIn = common.HexToAddress(config.Token0Contract)
+		tokenOut = common.HexToAddress(config.Token1Contract)
+	} else {
+		// Buying token0 with token1
+		decimals = config.Token1Decimals
+		tokenIn = common.HexToAddress(config.Token1Contract)
+		tokenOut = common.HexToAddress(config.Token0Contract)
+	}
+
+	feeTier := config.Fee
+	if feeTier == 0 {
+		feeTier = defaultFeeTier
+	}
+
+	return contracts.IV3SwapRouterExactInputSingleParams{
+		TokenIn:           tokenIn,
+		TokenOut:          tokenOut,
+		Recipient:         recipient,
+		AmountIn:          ToTokenUnits(amount, decimals), // Amount to swap (exact input)
+		Fee:               big.NewInt(int64(feeTier)),
+		SqrtPriceLimitX96: sqrtPriceLimitX96,
+		AmountOutMinimum:  amountOutMinimum,
+	}
+}
+
+// outputDecimals returns the decimals of the token the swap direction pays out.
+func outputDecimals(config *PoolConfig, zeroForOne bool) int {
+	if zeroForOne {
+		return config.Token1Decimals
+	}
+	return config.Token0Decimals
+}
+
+// pendingBlock makes CallContract execute against the pending block.
+var pendingBlock = big.NewInt(int64(rpc.PendingBlockNumber))
+
+// ToTokenUnits converts a human readable amount into the token's smallest unit.
+func ToTokenUnits(amount float64, decimals int) *big.Int {
+	decimalMultiplier := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	amountWithDecimals := new(big.Float).Mul(new(big.Float).SetFloat64(amount), decimalMultiplier)
+
+	amountInDecimals := new(big.Int)
+	amountWithDecimals.Int(amountInDecimals)
+	return amountInDecimals
+}
+
+// FromTokenUnits converts an amount in the token's smallest unit into a
+// human readable float.
+func FromTokenUnits(amount *big.Int, decimals int) float64 {
+	divisor := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	readable, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), divisor).Float64()
+	return readable
+}
+
+// revertReason extracts the revert reason from an eth_call error. It returns
+// false when the error is not a revert (e.g. a transport failure).
+func revertReason(err error) (string, bool) {
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if hexData, ok := dataErr.ErrorData().(string); ok {
+			if reason, unpackErr := abi.UnpackRevert(common.FromHex(hexData)); unpackErr == nil {
+				return reason, true
+			}
+		}
+		return dataErr.Error(), true
+	}
+	if strings.Contains(err.Error(), "execution reverted") {
+		return err.Error(), true
+	}
+	return "", false
+}
+
 func CalculatePrice(sqrtPriceX96 *big.Int, config *PoolConfig, desiredPair string) float64 {
 	// Convert sqrtPriceX96 to big.Float for precision
 	sqrtPriceX96Float := new(big.Float).SetInt(sqrtPriceX96)
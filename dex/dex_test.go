@@ -0,0 +1,120 @@
+package dex
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+func TestMinimumAmountOut(t *testing.T) {
+	// Arrange
+	expected := big.NewInt(1_000_000)
+
+	// Act
+	minimum := minimumAmountOut(expected, 0.001)
+
+	// Assert
+	if minimum.Cmp(big.NewInt(999_000)) != 0 {
+		t.Errorf("Expected minimum 999000, got %s", minimum)
+	}
+}
+
+func TestSqrtPriceLimit_Direction(t *testing.T) {
+	// Arrange
+	// sqrtPriceX96 for a price of 1
+	sqrtPrice := new(big.Int).Lsh(big.NewInt(1), 96)
+
+	// Act
+	down := sqrtPriceLimit(sqrtPrice, 0.01, true)
+	up := sqrtPriceLimit(sqrtPrice, 0.01, false)
+
+	// Assert
+	if down.Cmp(sqrtPrice) >= 0 {
+		t.Errorf("Expected zeroForOne limit below current price, got %s", down)
+	}
+	if up.Cmp(sqrtPrice) <= 0 {
+		t.Errorf("Expected oneForZero limit above current price, got %s", up)
+	}
+
+	// limit^2 / price^2 should equal the slippage factor
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(down), new(big.Float).SetInt(sqrtPrice)).Float64()
+	if got := ratio * ratio; got < 0.98999 || got > 0.99001 {
+		t.Errorf("Expected squared ratio 0.99, got %f", got)
+	}
+}
+
+func TestSqrtPriceLimit_ClampsToPoolBounds(t *testing.T) {
+	// Act
+	limit := sqrtPriceLimit(minSqrtRatio, 0.5, true)
+
+	// Assert
+	if limit.Cmp(minSqrtRatio) <= 0 {
+		t.Errorf("Expected limit above MIN_SQRT_RATIO, got %s", limit)
+	}
+}
+
+func TestResolveTokenContract(t *testing.T) {
+	// Arrange
+	token0 := common.HexToAddress("0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82")
+	token1 := common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+
+	// Act
+	missing := ""
+	errMissing := resolveTokenContract(&missing, token0, token1, "token0")
+	swapped := token1.Hex()
+	errSwapped := resolveTokenContract(&swapped, token0, token1, "token0")
+
+	// Assert
+	if errMissing != nil || missing != token0.Hex() {
+		t.Errorf("Expected missing contract to be filled with %s, got %q (%v)", token0.Hex(), missing, errMissing)
+	}
+	if errSwapped == nil || !strings.Contains(errSwapped.Error(), "wrong token order") {
+		t.Errorf("Expected wrong token order error, got %v", errSwapped)
+	}
+}
+
+func TestRequiredApprovals_UsesEachDexSpender(t *testing.T) {
+	// Arrange
+	blockchain.ActiveChain = &blockchain.Network{ChainName: "BSC", Network: blockchain.Mainnet}
+	cake := "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82"
+	usdt := "0x55d398326f99059fF775485246999027B3197955"
+	pancakePool := "0x7f51c8AaA6B0599aBd16674e2b17FEc7a9f674A1"
+	pool := func(address string) *PoolConfig {
+		return &PoolConfig{Token0: "CAKE", Token1: "USDT", Token0Contract: cake, Token1Contract: usdt, Address: address}
+	}
+	registryMu.Lock()
+	previous := registry
+	registry = map[string]*NetworkConfig{"BSC": {Mainnet: map[DexApp]map[string]*PoolConfig{
+		Pancakeswap: {"CAKE/USDT": pool(pancakePool)},
+		Uniswap:     {"CAKE/USDT": pool("0x0000000000000000000000000000000000000001")},
+	}}}
+	registryMu.Unlock()
+	defer func() {
+		registryMu.Lock()
+		registry = previous
+		registryMu.Unlock()
+	}()
+
+	// Act
+	approvals, err := RequiredApprovals("CAKE/USDT")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(approvals) != 4 {
+		t.Fatalf("Expected 4 approvals, got %d", len(approvals))
+	}
+	for _, approval := range approvals {
+		expected := common.HexToAddress(UniswapRouter)
+		if approval.Dex == Pancakeswap {
+			expected = common.HexToAddress(PancakeswapRouter)
+		}
+		if approval.Spender != expected {
+			t.Errorf("Expected %s spender %s, got %s", approval.Dex, expected.Hex(), approval.Spender.Hex())
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package dex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/contracts"
+)
+
+// FeeTiers lists the fee tiers enabled on each dex's V3 factory.
+var FeeTiers = map[DexApp][]uint32{
+	Uniswap:     {100, 500, 3000, 10000},
+	Pancakeswap: {100, 500, 2500, 10000},
+}
+
+// DiscoveredPool is a pool found through the factory together with its
+// in-range liquidity at the time of discovery.
+type DiscoveredPool struct {
+	Symbol    string
+	Config    *PoolConfig
+	Liquidity *big.Int
+}
+
+// PoolDiscovery finds V3 pools for a token pair by asking the dex factory
+// for the pool of every fee tier.
+type PoolDiscovery struct {
+	cl *blockchain.Client
+}
+
+func NewPoolDiscovery(cl *blockchain.Client) *PoolDiscovery {
+	return &PoolDiscovery{cl: cl}
+}
+
+// ListPools returns every existing pool for the pair on the dex, deepest first.
+func (d *PoolDiscovery) ListPools(ctx context.Context, tokenA, tokenB string, app DexApp) ([]*DiscoveredPool, error) {
+	tiers, exists := FeeTiers[app]
+	if !exists {
+		return nil, fmt.Errorf("no fee tiers known for %s", app)
+	}
+
+	factory, err := d.factory(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pools order their tokens by address, token0 being the lower one.
+	token0, token1 := common.HexToAddress(tokenA), common.HexToAddress(tokenB)
+	if bytes.Compare(token0.Bytes(), token1.Bytes()) > 0 {
+		token0, token1 = token1, token0
+	}
+
+	template, err := d.pairConfig(ctx, token0, token1)
+	if err != nil {
+		return nil, err
+	}
+	symbol := template.Token0 + "/" + template.Token1
+
+	var pools []*DiscoveredPool
+	for _, tier := range tiers {
+		poolAddress, err := factory.GetPool(&bind.CallOpts{Context: ctx}, token0, token1, big.NewInt(int64(tier)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up %s pool with fee %d: %w", symbol, tier, err)
+		}
+		if poolAddress == (common.Address{}) {
+			continue
+		}
+
+		liquidity, err := readPoolLiquidity(ctx, d.cl, app, poolAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read liquidity of %s: %w", poolAddress.Hex(), err)
+		}
+
+		config := *template
+		config.Address = poolAddress.Hex()
+		config.Fee = tier
+		pools = append(pools, &DiscoveredPool{Symbol: symbol, Config: &config, Liquidity: liquidity})
+
+		slog.Info("Discovered pool", "dex", app, "symbol", symbol, "fee", tier, "address", config.Address, "liquidity", liquidity)
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Liquidity.Cmp(pools[j].Liquidity) > 0
+	})
+	return pools, nil
+}
+
+// DeepestPool returns the pool with the most in-range liquidity for the pair.
+func (d *PoolDiscovery) DeepestPool(ctx context.Context, tokenA, tokenB string, app DexApp) (*DiscoveredPool, error) {
+	pools, err := d.ListPools(ctx, tokenA, tokenB, app)
+	if err != nil {
+		return nil, err
+	}
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("no %s pool exists for %s and %s", app, tokenA, tokenB)
+	}
+	return pools[0], nil
+}
+
+// DiscoverActivePools replaces the configured pool of every pair on the
+// active network with the deepest one the dex's factory knows, and adds the
+// pairs a configured dex does not list yet. It needs the token contracts
+// ValidatePoolConfigs fills in and must run before LoadPoolFees and before
+// trading starts.
+func (d *PoolDiscovery) DiscoverActivePools(ctx context.Context) error {
+	networkMap, err := activeNetworkPools()
+	if err != nil {
+		return err
+	}
+
+	pairs := make(map[string]*PoolConfig)
+	for _, pools := range networkMap {
+		for symbol, config := range pools {
+			if _, seen := pairs[symbol]; !seen {
+				pairs[symbol] = config
+			}
+		}
+	}
+
+	var errs []error
+	for app, pools := range networkMap {
+		for symbol, pair := range pairs {
+			deepest, err := d.DeepestPool(ctx, pair.Token0Contract, pair.Token1Contract, app)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", app, symbol, err))
+				continue
+			}
+
+			config := *pair
+			if configured, ok := pools[symbol]; ok {
+				config = *configured
+			}
+			if common.HexToAddress(config.Address) != common.HexToAddress(deepest.Config.Address) {
+				slog.Info("Using deepest pool", "dex", app, "symbol", symbol, "configured", config.Address, "discovered", deepest.Config.Address)
+			}
+			config.Address = deepest.Config.Address
+			config.Fee = deepest.Config.Fee
+			pools[symbol] = &config
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// factory resolves the dex's V3 factory through its router.
+func (d *PoolDiscovery) factory(ctx context.Context, app DexApp) (*contracts.V3Factory, error) {
+	routerAddress, err := routerFor(app)
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := contracts.NewSwapRouter(common.HexToAddress(routerAddress), d.cl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create router contract: %w", err)
+	}
+	factoryAddress, err := router.Factory(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read factory from %s router: %w", app, err)
+	}
+
+	return contracts.NewV3Factory(factoryAddress, d.cl)
+}
+
+// pairConfig builds the token half of a PoolConfig from the ERC20 contracts.
+func (d *PoolDiscovery) pairConfig(ctx context.Context, token0, token1 common.Address) (*PoolConfig, error) {
+	symbol0, decimals0, err := tokenMetadata(ctx, d.cl, token0)
+	if err != nil {
+		return nil, err
+	}
+	symbol1, decimals1, err := tokenMetadata(ctx, d.cl, token1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PoolConfig{
+		Token0:         symbol0,
+		Token1:         symbol1,
+		Token0Contract: token0.Hex(),
+		Token1Contract: token1.Hex(),
+		Token0Decimals: decimals0,
+		Token1Decimals: decimals1,
+	}, nil
+}
+
+func routerFor(app DexApp) (string, error) {
+	var router string
+	switch app {
+	case Uniswap:
+		router = UniswapRouter
+	case Pancakeswap:
+		router = PancakeswapRouter
+	}
+	if router == "" {
+		return "", fmt.Errorf("no router configured for %s", app)
+	}
+	return router, nil
+}
+
+func tokenMetadata(ctx context.Context, cl *blockchain.Client, token common.Address) (string, int, error) {
+	erc20, err := contracts.NewERC20(token, cl)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create ERC20 contract: %w", err)
+	}
+	symbol, err := erc20.Symbol(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read symbol of %s: %w", token.Hex(), err)
+	}
+	decimals, err := erc20.Decimals(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read decimals of %s: %w", token.Hex(), err)
+	}
+	return symbol, int(decimals), nil
+}
+
+func readPoolLiquidity(ctx context.Context, cl *blockchain.Client, app DexApp, poolAddress common.Address) (*big.Int, error) {
+	switch app {
+	case Pancakeswap:
+		pool, err := contracts.NewPancakeswapV3Pool(poolAddress, cl)
+		if err != nil {
+			return nil, err
+		}
+		return pool.Liquidity(&bind.CallOpts{Context: ctx})
+	default:
+		pool, err := contracts.NewUniswapV3Pool(poolAddress, cl)
+		if err != nil {
+			return nil, err
+		}
+		return pool.Liquidity(&bind.CallOpts{Context: ctx})
+	}
+}
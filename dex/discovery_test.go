@@ -0,0 +1,146 @@
+package dex
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/contracts"
+)
+
+var testFactory = common.HexToAddress("0x0000000000000000000000000000000000000fac")
+
+// fakeFactoryChain serves the Uniswap router and factory with a pool of the
+// test tokens at every fee tier that has a liquidity, and no pool at the
+// others.
+func fakeFactoryChain(t *testing.T, liquidity map[uint32]int64) *fakeChain {
+	chain := fakePoolChain(t)
+	chain.respond(common.HexToAddress(UniswapRouter), contracts.SwapRouterMetaData, "factory", testFactory)
+	for i, tier := range FeeTiers[Uniswap] {
+		pool := common.Address{}
+		if amount, ok := liquidity[tier]; ok {
+			pool = common.BigToAddress(big.NewInt(int64(0xb00 + i)))
+			chain.respond(pool, contracts.UniswapV3PoolMetaData, "liquidity", big.NewInt(amount))
+		}
+		// Pools are only looked up by their sorted tokens.
+		chain.respondTo(testFactory, contracts.V3FactoryMetaData, "getPool",
+			[]any{testToken0, testToken1, big.NewInt(int64(tier))}, pool)
+	}
+	return chain
+}
+
+func TestListPools_OrdersTokensByAddress(t *testing.T) {
+	// Arrange
+	discovery := NewPoolDiscovery(fakeFactoryChain(t, map[uint32]int64{500: 1000}).client())
+
+	// Act
+	pools, err := discovery.ListPools(context.Background(), testToken1.Hex(), testToken0.Hex(), Uniswap)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(pools) != 1 {
+		t.Fatalf("Expected 1 pool, got %d", len(pools))
+	}
+	pool := pools[0]
+	if pool.Symbol != "WETH/USDC" {
+		t.Errorf("Expected symbol WETH/USDC, got %s", pool.Symbol)
+	}
+	if pool.Config.Token0Contract != testToken0.Hex() || pool.Config.Token1Contract != testToken1.Hex() {
+		t.Errorf("Expected token0 %s and token1 %s, got %s and %s",
+			testToken0.Hex(), testToken1.Hex(), pool.Config.Token0Contract, pool.Config.Token1Contract)
+	}
+	if pool.Config.Token0Decimals != 18 || pool.Config.Token1Decimals != 6 {
+		t.Errorf("Expected decimals 18 and 6, got %d and %d", pool.Config.Token0Decimals, pool.Config.Token1Decimals)
+	}
+	if pool.Config.Fee != 500 {
+		t.Errorf("Expected fee 500, got %d", pool.Config.Fee)
+	}
+}
+
+func TestDeepestPool_PicksMostLiquidity(t *testing.T) {
+	// Arrange
+	discovery := NewPoolDiscovery(fakeFactoryChain(t, map[uint32]int64{100: 10, 500: 5000, 3000: 700}).client())
+
+	// Act
+	pools, listErr := discovery.ListPools(context.Background(), testToken0.Hex(), testToken1.Hex(), Uniswap)
+	deepest, err := discovery.DeepestPool(context.Background(), testToken0.Hex(), testToken1.Hex(), Uniswap)
+
+	// Assert
+	if listErr != nil || err != nil {
+		t.Fatalf("Expected no error, got %v and %v", listErr, err)
+	}
+	expected := []uint32{500, 3000, 100}
+	if len(pools) != len(expected) {
+		t.Fatalf("Expected %d pools, got %d", len(expected), len(pools))
+	}
+	for i, fee := range expected {
+		if pools[i].Config.Fee != fee {
+			t.Errorf("Expected pool %d to have fee %d, got %d", i, fee, pools[i].Config.Fee)
+		}
+	}
+	if deepest.Config.Fee != 500 || deepest.Liquidity.Int64() != 5000 {
+		t.Errorf("Expected the 500 pool with liquidity 5000, got fee %d with %s", deepest.Config.Fee, deepest.Liquidity)
+	}
+}
+
+func TestDeepestPool_FailsWithoutPool(t *testing.T) {
+	// Arrange
+	discovery := NewPoolDiscovery(fakeFactoryChain(t, nil).client())
+
+	// Act
+	_, err := discovery.DeepestPool(context.Background(), testToken0.Hex(), testToken1.Hex(), Uniswap)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error when the factory has no pool")
+	}
+}
+
+func TestDiscoverActivePools_UsesDeepestPool(t *testing.T) {
+	// Arrange
+	blockchain.ActiveChain = &blockchain.Network{ChainName: "ETH", Network: blockchain.Mainnet}
+	configured := &PoolConfig{
+		Token0:         "ETH",
+		Token1:         "USDC",
+		Token0Contract: testToken0.Hex(),
+		Token1Contract: testToken1.Hex(),
+		Token0Decimals: 18,
+		Token1Decimals: 6,
+		Address:        "0x0000000000000000000000000000000000000001",
+	}
+	registryMu.Lock()
+	previous := registry
+	registry = map[string]*NetworkConfig{"ETH": {Mainnet: map[DexApp]map[string]*PoolConfig{
+		Uniswap: {"ETH/USDC": configured},
+	}}}
+	registryMu.Unlock()
+	defer func() {
+		registryMu.Lock()
+		registry = previous
+		registryMu.Unlock()
+	}()
+	discovery := NewPoolDiscovery(fakeFactoryChain(t, map[uint32]int64{500: 10, 3000: 700}).client())
+
+	// Act
+	err := discovery.DiscoverActivePools(context.Background())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	config, err := GetActiveMarkets("ETH/USDC", Uniswap)
+	if err != nil {
+		t.Fatalf("Expected the pair to stay configured, got %v", err)
+	}
+	expected := common.BigToAddress(big.NewInt(0xb02))
+	if common.HexToAddress(config.Address) != expected || config.Fee != 3000 {
+		t.Errorf("Expected the 3000 pool %s, got %s with fee %d", expected.Hex(), config.Address, config.Fee)
+	}
+	if config.Token0 != "ETH" {
+		t.Errorf("Expected the configured alias ETH to be kept, got %s", config.Token0)
+	}
+}
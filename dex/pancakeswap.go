@@ -1,179 +1,225 @@
 package dex
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"math/big"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/v2"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/sagarkarki99/arbitrator/constants"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/sagarkarki99/arbitrator/blockchain"
 	"github.com/sagarkarki99/arbitrator/contracts"
 	"github.com/sagarkarki99/arbitrator/keychain"
 )
 
-func NewPancakeswapV2Pool(client *ethclient.Client, kc keychain.Keychain) Dex {
+func NewPancakeswapV2Pool(client *blockchain.Client, kc keychain.Keychain) Dex {
 	pool := &PancakeswapV2Pool{
-		cl:          client,
-		subs:        make(map[string]chan *Price),
-		platformFee: 0.0025, // 0.25% platform fee
-		kc:          kc,
+		cl:             client,
+		feeds:          NewPriceFeeds(DefaultPriceBuffer),
+		clock:          newBlockClock(client),
+		defaultFeeTier: 2500, // 0.25% tier until LoadPoolFees reads the pool's fee
+		kc:             kc,
 	}
 
 	return pool
 }
 
 type PancakeswapV2Pool struct {
-	cl          *ethclient.Client
-	subs        map[string]chan *Price
-	platformFee float64
-	kc          keychain.Keychain
+	cl             *blockchain.Client
+	feeds          *PriceFeeds
+	clock          *blockClock
+	defaultFeeTier uint32
+	kc             keychain.Keychain
 }
 
-func (p *PancakeswapV2Pool) GetPrice(symbol string) (<-chan *Price, error) {
-	if sub, exists := p.subs[symbol]; exists {
-		return sub, nil
-	}
+func (p *PancakeswapV2Pool) GetPrice(ctx context.Context, symbol string) (*PriceSubscription, error) {
+	return p.feeds.Subscribe(ctx, symbol, func(ctx context.Context, publish func(*Price)) error {
+		return p.watchPool(ctx, symbol, publish)
+	})
+}
 
+// watchPool publishes the prices of symbol's pool until ctx is cancelled.
+func (p *PancakeswapV2Pool) watchPool(ctx context.Context, symbol string, publish func(*Price)) error {
 	config, err := GetActiveMarkets(symbol, Pancakeswap)
 	if err != nil {
-		return nil, fmt.Errorf("no pool found for symbol %s", symbol)
+		return fmt.Errorf("no pool found for symbol %s", symbol)
 	}
 
 	poolAddress := common.HexToAddress(config.Address)
 	pool, err := contracts.NewPancakeswapV3Pool(poolAddress, p.cl)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	swapChan := make(chan *contracts.PancakeswapV3PoolSwap)
-	priceChan := make(chan *Price)
+	slog.Info("Subscribing to Pancakeswap pool", "symbol", symbol, "address", config.Address)
+
+	stream := swapStream[*contracts.PancakeswapV3PoolSwap]{
+		name: "Pancakeswap " + symbol,
+		watch: func(opts *bind.WatchOpts, sink chan<- *contracts.PancakeswapV3PoolSwap) (event.Subscription, error) {
+			return pool.WatchSwap(opts, sink, nil, nil)
+		},
+		filter: func(opts *bind.FilterOpts) ([]*contracts.PancakeswapV3PoolSwap, error) {
+			it, err := pool.FilterSwap(opts, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			defer it.Close()
+			var swaps []*contracts.PancakeswapV3PoolSwap
+			for it.Next() {
+				swaps = append(swaps, it.Event)
+			}
+			return swaps, it.Error()
+		},
+		log: func(swap *contracts.PancakeswapV3PoolSwap) types.Log { return swap.Raw },
+		rollback: func(block uint64) {
+			price, err := p.PriceAt(ctx, symbol, block)
+			if err != nil {
+				slog.Error("Failed to read price after reorg", "pool", "Pancakeswap", "symbol", symbol, "block", block, "error", err)
+				return
+			}
+			price.RolledBack = true
+			publish(price)
+		},
+		polling: activePolling(),
+	}
+	go func() {
+		streamSwaps(ctx, p.cl, stream, func(swapEvent *contracts.PancakeswapV3PoolSwap) {
+			receivedAt := time.Now()
+			publish(&Price{
+				Pool:            "Pancakeswap",
+				Symbol:          symbol,
+				Price:           CalculatePrice(swapEvent.SqrtPriceX96, config, symbol),
+				Liquidity:       swapEvent.Liquidity,
+				LiquidityStatus: liquidityStatus(swapEvent.Liquidity),
+				BlockNumber:     swapEvent.Raw.BlockNumber,
+				LogIndex:        swapEvent.Raw.Index,
+				TxHash:          swapEvent.Raw.TxHash,
+				BlockTimestamp:  p.clock.timestamp(ctx, swapEvent.Raw.BlockNumber),
+				ReceivedAt:      receivedAt,
+			})
+		})
+	}()
+	return nil
+}
 
-	sub, err := pool.WatchSwap(&bind.WatchOpts{}, swapChan, nil, nil)
+func (p *PancakeswapV2Pool) PriceAt(ctx context.Context, symbol string, block uint64) (*Price, error) {
+	config, err := GetActiveMarkets(symbol, Pancakeswap)
+	if err != nil {
+		return nil, fmt.Errorf("no pool found for symbol %s", symbol)
+	}
+	pool, err := contracts.NewPancakeswapV3Pool(common.HexToAddress(config.Address), p.cl)
 	if err != nil {
-		return nil, fmt.Errorf("could not subscribe to swap events: %w", err)
+		return nil, fmt.Errorf("failed to create pool contract: %w", err)
 	}
 
-	p.subs[symbol] = priceChan
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)}
+	slot0, err := pool.Slot0(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool price at block %d: %w", block, err)
+	}
+	liquidity, err := pool.Liquidity(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool liquidity at block %d: %w", block, err)
+	}
+	return &Price{
+		Pool:            "Pancakeswap",
+		Symbol:          symbol,
+		Price:           CalculatePrice(slot0.SqrtPriceX96, config, symbol),
+		Liquidity:       liquidity,
+		LiquidityStatus: liquidityStatus(liquidity),
+		BlockNumber:     block,
+		BlockTimestamp:  p.clock.timestamp(ctx, block),
+		ReceivedAt:      time.Now(),
+	}, nil
+}
 
-	go func() {
-		defer func() {
-			sub.Unsubscribe()
-			close(priceChan)
-			delete(p.subs, symbol)
-			slog.Info("Unsubscribing from Pancakeswap V2 pool", "symbol", symbol, "address", config.Address)
-		}()
-		// for i := 0; i < 3; i++ {
-		// 	price := (1000 + rand.Float64()*5) // Random price between 1000-1100
-		// 	time.Sleep(time.Second * 2)
-		// 	priceChan <- &Price{
-		// 		Pool:            "Pancakeswap",
-		// 		Symbol:          symbol,
-		// 		Price:           price,
-		// 		Liquidity:       big.NewInt(1000000), // Example liquidity value
-		// 		LiquidityStatus: "high",
-		// 	}
-		// }
-		// close(priceChan)
-		for {
-			select {
-			case err := <-sub.Err():
-				slog.Error("Error in Pancakeswap V2 pool subscription", "error", err)
-				return
-			case swapEvent := <-swapChan:
-				price := CalculatePrice(swapEvent.SqrtPriceX96, config, symbol)
-				status := "high"
-				if swapEvent.Liquidity.Cmp(big.NewInt(1e10)) < 0 {
-					status = "low"
-				}
-				priceChan <- &Price{
-					Pool:            "Pancakeswap",
-					Symbol:          symbol,
-					Price:           price,
-					Liquidity:       swapEvent.Liquidity,
-					LiquidityStatus: status,
-				}
-			}
-		}
-	}()
-	return priceChan, nil
+// liquidityStatus flags pools whose in-range liquidity is too thin to trade.
+func liquidityStatus(liquidity *big.Int) string {
+	if liquidity.Cmp(big.NewInt(1e10)) < 0 {
+		return "low"
+	}
+	return "high"
 }
 
-func (p *PancakeswapV2Pool) Buy(amount float64, symbol string) (string, error) {
-	return p.performSwap(amount, symbol, false)
+func (p *PancakeswapV2Pool) Buy(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*SwapResult, error) {
+	return p.performSwap(ctx, from, amount, symbol, false, slippage)
 }
 
-func (p *PancakeswapV2Pool) Sell(amount float64, symbol string) (string, error) {
-	return p.performSwap(amount, symbol, true)
+func (p *PancakeswapV2Pool) Sell(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*SwapResult, error) {
+	return p.performSwap(ctx, from, amount, symbol, true, slippage)
 }
 
 // Helper function to perform swaps with common logic
-func (p *PancakeswapV2Pool) performSwap(amount float64, symbol string, zeroForOne bool) (string, error) {
+//
+// Swaps go through the SmartRouter's exactInputSingle: the router pulls the
+// input token under the account's approval, pays the pool in its swap
+// callback and enforces the minimum output on-chain.
+func (p *PancakeswapV2Pool) performSwap(ctx context.Context, from common.Address, amount float64, symbol string, zeroForOne bool, slippage float64) (*SwapResult, error) {
 	// Step 1: Get pool configuration
 	config, err := GetActiveMarkets(symbol, Pancakeswap)
 	if err != nil {
-		return "", fmt.Errorf("pool configuration not found for symbol: %s", symbol)
+		return nil, fmt.Errorf("pool configuration not found for symbol: %s", symbol)
 	}
 
-	// Step 3: Initialize pool contract
+	// Step 2: Quote the swap and derive the slippage protections from it
+	quote, err := p.simulateSwap(ctx, from, amount, symbol, zeroForOne)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote swap: %w", err)
+	}
+	if quote.Reverted {
+		return nil, fmt.Errorf("swap quote reverted: %s", quote.RevertReason)
+	}
 	poolAddress := common.HexToAddress(config.Address)
 	pool, err := contracts.NewPancakeswapV3Pool(poolAddress, p.cl)
 	if err != nil {
 		slog.Error("Could not create pancakeswap pool", "error", err)
-		return "", fmt.Errorf("failed to create pool contract: %w", err)
+		return nil, fmt.Errorf("failed to create pool contract: %w", err)
 	}
-
-	// Step 4: Set up transaction parameters
-	myAddress := common.HexToAddress(keychain.Accounts[0])
-
-	// Step 5: Calculate amount with proper decimals
-	var decimals int
-	var fromToken, toToken string
-
-	if zeroForOne {
-		// Selling token0 for token1
-		decimals = config.Token0Decimals
-		fromToken = config.Token0
-		toToken = config.Token1
-	} else {
-		// Buying token0 with token1
-		decimals = config.Token1Decimals
-		fromToken = config.Token1
-		toToken = config.Token0
+	slot0, err := pool.Slot0(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool price: %w", err)
 	}
 
-	decimalMultiplier := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
-	amountFloat := new(big.Float).SetFloat64(amount)
-	amountWithDecimals := new(big.Float).Mul(amountFloat, decimalMultiplier)
-
-	amountInDecimals := new(big.Int)
-	amountWithDecimals.Int(amountInDecimals) // Convert to big.Int
+	result := &SwapResult{
+		AmountIn:          quote.AmountIn,
+		ExpectedAmountOut: quote.AmountOut,
+		AmountOutMinimum:  minimumAmountOut(quote.AmountOut, slippage),
+		SqrtPriceLimitX96: sqrtPriceLimit(slot0.SqrtPriceX96, slippage, zeroForOne),
+	}
+	result.AmountOutMinimumReadable = FromTokenUnits(result.AmountOutMinimum, outputDecimals(config, zeroForOne))
+	params := exactInputSingleParams(config, p.defaultFeeTier, amount, zeroForOne, from, result.AmountOutMinimum, result.SqrtPriceLimitX96)
 
-	// Step 6: Prepare transaction options
+	// Step 3: Prepare transaction options
+	nonce, err := p.cl.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
 	auth := &bind.TransactOpts{
-		From:      myAddress,
-		Nonce:     big.NewInt(int64(15)),
-		Value:     big.NewInt(0), // No ETH value for token swaps
-		GasFeeCap: constants.GasFeeCap,
-		GasTipCap: constants.GasTipCap,
+		Context: ctx,
+		From:    from,
+		Nonce:   new(big.Int).SetUint64(nonce),
+		Value:   big.NewInt(0), // No ETH value for token swaps
 		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
-			return p.kc.Sign(tx)
+			return p.kc.Sign(ctx, address, tx)
 		},
 	}
+	if err := p.cl.SetFees(ctx, auth); err != nil {
+		return nil, err
+	}
+
+	router, err := contracts.NewSwapRouter(common.HexToAddress(PancakeswapRouter), p.cl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create router contract: %w", err)
+	}
 
 	tm := time.Now()
-	// Step 7: Execute the swap
-	tx, err := pool.Swap(
-		auth,
-		myAddress,        // recipient
-		zeroForOne,       // swap direction
-		amountInDecimals, // amountSpecified (exact input)
-		big.NewInt(0),    // sqrtPriceLimitX96 (no limit)
-		[]byte{},         // data (empty)
-	)
+	// Step 4: Execute the swap
+	tx, err := router.ExactInputSingle(auth, params)
 
 	elasped := time.Since(tm)
 	slog.Info("Swap execution time", "duration", elasped)
@@ -183,22 +229,99 @@ func (p *PancakeswapV2Pool) performSwap(amount float64, symbol string, zeroForOn
 			"error", err,
 			"symbol", symbol,
 			"amount", amount,
-			"nonce", 18,
+			"nonce", nonce,
 			"pool_address", poolAddress.Hex())
-		return "", fmt.Errorf("failed to execute swap: %w", err)
+		return nil, fmt.Errorf("failed to execute swap: %w", err)
 	}
+	result.Hash = tx.Hash().Hex()
 
+	fromToken, toToken := swapTokens(config, zeroForOne)
 	slog.Info("Swap transaction submitted",
-		"hash", tx.Hash().Hex(),
+		"hash", result.Hash,
 		"symbol", symbol,
 		"amount", amount,
 		"from_token", fromToken,
 		"to_token", toToken,
-		"zero_for_one", zeroForOne)
+		"zero_for_one", zeroForOne,
+		"expected_amount_out", result.ExpectedAmountOut.String(),
+		"amount_out_minimum", result.AmountOutMinimum.String(),
+		"sqrt_price_limit_x96", result.SqrtPriceLimitX96.String(),
+		"slippage", slippage)
+
+	return result, nil
+}
+
+// swapTokens returns the input and output token symbols for the swap direction.
+func swapTokens(config *PoolConfig, zeroForOne bool) (string, string) {
+	if zeroForOne {
+		// Selling token0 for token1
+		return config.Token0, config.Token1
+	}
+	// Buying token0 with token1
+	return config.Token1, config.Token0
+}
+
+// simulateSwap packs the same exactInputSingle call performSwap would send,
+// without its protections, and executes it with eth_call against the pending
+// block.
+func (p *PancakeswapV2Pool) simulateSwap(ctx context.Context, from common.Address, amount float64, symbol string, zeroForOne bool) (*SwapSimulation, error) {
+	config, err := GetActiveMarkets(symbol, Pancakeswap)
+	if err != nil {
+		return nil, fmt.Errorf("pool configuration not found for symbol: %s", symbol)
+	}
+
+	params := exactInputSingleParams(config, p.defaultFeeTier, amount, zeroForOne, from, big.NewInt(0), big.NewInt(0))
+
+	routerAbi, err := contracts.SwapRouterMetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load router abi: %w", err)
+	}
+	calldata, err := swapCalldata(routerAbi, params, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack swap calldata: %w", err)
+	}
+
+	router := common.HexToAddress(PancakeswapRouter)
+	result := &SwapSimulation{
+		Pool:       "Pancakeswap",
+		Symbol:     symbol,
+		ZeroForOne: zeroForOne,
+		AmountIn:   params.AmountIn,
+		AmountOut:  big.NewInt(0),
+	}
+
+	output, err := p.cl.CallContract(ctx, ethereum.CallMsg{
+		From: from,
+		To:   &router,
+		Data: calldata,
+	}, pendingBlock)
+	if err != nil {
+		reason, reverted := revertReason(err)
+		if !reverted {
+			return nil, fmt.Errorf("failed to simulate swap: %w", err)
+		}
+		result.Reverted = true
+		result.RevertReason = reason
+		return result, nil
+	}
+
+	if result.AmountOut, err = swapOutput(routerAbi, output, false); err != nil {
+		return nil, fmt.Errorf("failed to decode simulated swap output: %w", err)
+	}
+
+	result.AmountOutReadable = FromTokenUnits(result.AmountOut, outputDecimals(config, zeroForOne))
+	return result, nil
+}
+
+func (p *PancakeswapV2Pool) SimulateBuy(ctx context.Context, from common.Address, amount float64, symbol string) (*SwapSimulation, error) {
+	return p.simulateSwap(ctx, from, amount, symbol, false)
+}
 
-	return tx.Hash().Hex(), nil
+func (p *PancakeswapV2Pool) SimulateSell(ctx context.Context, from common.Address, amount float64, symbol string) (*SwapSimulation, error) {
+	return p.simulateSwap(ctx, from, amount, symbol, true)
 }
 
-func (p *PancakeswapV2Pool) GetPoolFee() float64 {
-	return p.platformFee
+func (p *PancakeswapV2Pool) GetPoolFee(symbol string) float64 {
+	config, _ := GetActiveMarkets(symbol, Pancakeswap)
+	return feeRatio(config, p.defaultFeeTier)
 }
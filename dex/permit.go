@@ -0,0 +1,226 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/contracts"
+	"github.com/sagarkarki99/arbitrator/keychain"
+)
+
+// permitValidity is how long a signed permit may be submitted for. A cached
+// permit is re-signed once less than half of it is left.
+const permitValidity = 10 * time.Minute
+
+var errNoPermit = errors.New("token does not support EIP-2612 permits")
+
+// signedPermit is a packed selfPermitIfNecessary call, reusable until the
+// token's nonce moves or the deadline comes close.
+type signedPermit struct {
+	nonce    *big.Int
+	deadline time.Time
+	call     []byte
+}
+
+// SupportsPermit reports whether token implements EIP-2612 with a domain
+// separator this adapter can reproduce. The answer is cached per token.
+func (u *UniswapV3) SupportsPermit(ctx context.Context, token common.Address) bool {
+	_, err := u.permitDomain(ctx, token)
+	return err == nil
+}
+
+func (u *UniswapV3) permitDomain(ctx context.Context, token common.Address) (*apitypes.TypedDataDomain, error) {
+	u.permitMu.Lock()
+	domain, known := u.permitDomains[token]
+	u.permitMu.Unlock()
+	if !known {
+		var err error
+		if domain, err = readPermitDomain(ctx, u.cl, token); err != nil {
+			// A cancelled read says nothing about the token, so it is not
+			// cached.
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			slog.Info("Token has no usable permit, falling back to approvals", "token", token.Hex(), "reason", err)
+		}
+		u.permitMu.Lock()
+		u.permitDomains[token] = domain
+		u.permitMu.Unlock()
+	}
+	if domain == nil {
+		return nil, errNoPermit
+	}
+	return domain, nil
+}
+
+// readPermitDomain rebuilds the token's EIP-712 domain. Tokens rarely expose
+// their version, so common versions are tried until the hash matches
+// DOMAIN_SEPARATOR().
+func readPermitDomain(ctx context.Context, cl *blockchain.Client, token common.Address) (*apitypes.TypedDataDomain, error) {
+	permit, err := contracts.NewERC20Permit(token, cl)
+	if err != nil {
+		return nil, err
+	}
+	separator, err := permit.DOMAINSEPARATOR(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("no DOMAIN_SEPARATOR: %w", err)
+	}
+	if _, err := permit.Nonces(&bind.CallOpts{Context: ctx}, common.Address{}); err != nil {
+		return nil, fmt.Errorf("no nonces: %w", err)
+	}
+	name, err := permit.Name(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("no name: %w", err)
+	}
+
+	versions := []string{"1", "2", ""}
+	if version, err := permit.Version(&bind.CallOpts{Context: ctx}); err == nil {
+		versions = append([]string{version}, versions...)
+	}
+	chainID := math.NewHexOrDecimal256(int64(blockchain.ActiveChain.ChainID))
+	for _, version := range versions {
+		domain := apitypes.TypedDataDomain{
+			Name:              name,
+			Version:           version,
+			ChainId:           chainID,
+			VerifyingContract: token.Hex(),
+		}
+		hash, err := domainSeparator(domain)
+		if err == nil && hash == separator {
+			return &domain, nil
+		}
+	}
+	return nil, errors.New("DOMAIN_SEPARATOR matches no known domain layout")
+}
+
+func domainSeparator(domain apitypes.TypedDataDomain) (common.Hash, error) {
+	typedData := apitypes.TypedData{
+		Types:  apitypes.Types{"EIP712Domain": keychain.DomainTypes(domain)},
+		Domain: domain,
+	}
+	hash, err := typedData.HashStruct("EIP712Domain", domain.Map())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(hash), nil
+}
+
+// permitCall signs a max permit for the router and packs it as a
+// selfPermitIfNecessary call to batch in front of the swap.
+func (u *UniswapV3) permitCall(ctx context.Context, owner, token common.Address) ([]byte, error) {
+	domain, err := u.permitDomain(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	permit, err := contracts.NewERC20Permit(token, u.cl)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := permit.Nonces(&bind.CallOpts{Context: ctx}, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permit nonce: %w", err)
+	}
+
+	key := [2]common.Address{owner, token}
+	u.permitMu.Lock()
+	cached := u.permits[key]
+	u.permitMu.Unlock()
+	if cached != nil && cached.nonce.Cmp(nonce) == 0 && time.Until(cached.deadline) > permitValidity/2 {
+		return cached.call, nil
+	}
+
+	router := common.HexToAddress(UniswapRouter)
+	deadline := time.Now().Add(permitValidity)
+	deadlineUnix := big.NewInt(deadline.Unix())
+	typedData := keychain.PermitTypedData(*domain, owner, router, abi.MaxUint256, nonce, deadlineUnix)
+	signature, err := u.kc.SignTypedData(ctx, owner, typedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign permit: %w", err)
+	}
+
+	routerAbi, err := contracts.SwapRouterMetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load router abi: %w", err)
+	}
+	call, err := routerAbi.Pack("selfPermitIfNecessary", token, abi.MaxUint256, deadlineUnix,
+		signature[64], [32]byte(signature[:32]), [32]byte(signature[32:64]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack permit: %w", err)
+	}
+
+	u.permitMu.Lock()
+	u.permits[key] = &signedPermit{nonce: nonce, deadline: deadline, call: call}
+	u.permitMu.Unlock()
+	slog.Info("Signed permit for router", "token", token.Hex(), "nonce", nonce, "deadline", deadline)
+	return call, nil
+}
+
+// routerAuthorization decides how the router may pull amount of tokenIn.
+// covered is true when the existing allowance suffices or permit, the
+// selfPermitIfNecessary call to batch with the swap, grants it.
+func (u *UniswapV3) routerAuthorization(ctx context.Context, owner, tokenIn common.Address, amount *big.Int) (permit []byte, covered bool, err error) {
+	erc20, err := contracts.NewERC20(tokenIn, u.cl)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create ERC20 contract: %w", err)
+	}
+	allowance, err := erc20.Allowance(&bind.CallOpts{Context: ctx}, owner, common.HexToAddress(UniswapRouter))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read router allowance: %w", err)
+	}
+	if allowance.Cmp(amount) >= 0 {
+		return nil, true, nil
+	}
+	if !u.SupportsPermit(ctx, tokenIn) {
+		return nil, false, nil
+	}
+	if permit, err = u.permitCall(ctx, owner, tokenIn); err != nil {
+		return nil, false, err
+	}
+	return permit, true, nil
+}
+
+// swapCalldata packs exactInputSingle, batched behind permit in a multicall
+// when one is given.
+func swapCalldata(routerAbi *abi.ABI, params contracts.IV3SwapRouterExactInputSingleParams, permit []byte) ([]byte, error) {
+	swap, err := routerAbi.Pack("exactInputSingle", params)
+	if err != nil || permit == nil {
+		return swap, err
+	}
+	return routerAbi.Pack("multicall1", [][]byte{permit, swap})
+}
+
+// swapOutput decodes amountOut from the result of swapCalldata.
+func swapOutput(routerAbi *abi.ABI, output []byte, batched bool) (*big.Int, error) {
+	if batched {
+		results, err := routerAbi.Unpack("multicall1", output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode multicall output: %w", err)
+		}
+		if len(results) == 0 {
+			return nil, errors.New("multicall output is empty")
+		}
+		calls, ok := results[0].([][]byte)
+		if !ok || len(calls) == 0 {
+			return nil, errors.New("multicall returned no results")
+		}
+		output = calls[len(calls)-1]
+	}
+	unpacked, err := routerAbi.Unpack("exactInputSingle", output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode swap output: %w", err)
+	}
+	if len(unpacked) == 0 {
+		return nil, errors.New("swap output is empty")
+	}
+	return unpacked[0].(*big.Int), nil
+}
@@ -1,10 +1,17 @@
 package dex
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"math/big"
+	"sort"
+	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/contracts"
 )
 
 type Price struct {
@@ -13,16 +20,41 @@ type Price struct {
 	Price           float64
 	Liquidity       *big.Int
 	LiquidityStatus string
+	// BlockNumber is the block the price was observed in. LogIndex and TxHash
+	// identify the swap that set it; they are zero for prices read from the
+	// pool's state.
+	BlockNumber uint64
+	LogIndex    uint
+	TxHash      common.Hash
+	// BlockTimestamp is zero when the block header could not be read.
+	BlockTimestamp time.Time
+	// ReceivedAt is when the price reached this process.
+	ReceivedAt time.Time
+	// RolledBack is set when the price is re-sent because the swaps after
+	// BlockNumber were reorged out.
+	RolledBack bool
+}
+
+// Age is how old the price is at now, by its block timestamp or, when that
+// is unknown, by when it was received.
+func (p *Price) Age(now time.Time) time.Duration {
+	if !p.BlockTimestamp.IsZero() {
+		return now.Sub(p.BlockTimestamp)
+	}
+	return now.Sub(p.ReceivedAt)
 }
 
 type PoolConfig struct {
-	Token0         string
-	Token1         string
-	Token0Contract string
-	Token1Contract string
-	Token0Decimals int
-	Token1Decimals int
-	Address        string
+	Token0         string `json:"token0"`
+	Token1         string `json:"token1"`
+	Token0Contract string `json:"token0Contract,omitempty"`
+	Token1Contract string `json:"token1Contract,omitempty"`
+	Token0Decimals int    `json:"token0Decimals"`
+	Token1Decimals int    `json:"token1Decimals"`
+	Address        string `json:"address"`
+	// Fee is the pool's fee tier in hundredths of a bip (3000 = 0.3%),
+	// populated from the pool's fee() by LoadPoolFees.
+	Fee uint32 `json:"fee,omitempty"`
 }
 
 // NetworkConfig holds pool configurations for mainnet and testnet
@@ -31,7 +63,8 @@ type NetworkConfig struct {
 	Testnet map[DexApp]map[string]*PoolConfig
 }
 
-// ChainConfigs organizes pool configurations by chain
+// ChainConfigs organizes pool configurations by chain. These are the built-in
+// defaults; LoadRegistry can replace or extend them from a file.
 var ChainConfigs = map[string]*NetworkConfig{
 	"ethereum": {
 		Mainnet: map[DexApp]map[string]*PoolConfig{
@@ -96,7 +129,7 @@ var ChainConfigs = map[string]*NetworkConfig{
 				"USDT/WBNB": {
 					Token0:         "USDT",
 					Token1:         "WBNB",
-					Token0Decimals: 6,
+					Token0Decimals: 18,
 					Token1Decimals: 18,
 					Address:        "0x47a90A2d92A8367A91EfA1906bFc8c1E05bf10c4",
 				},
@@ -104,7 +137,7 @@ var ChainConfigs = map[string]*NetworkConfig{
 					Token0:         "CAKE",
 					Token1:         "USDT",
 					Token0Decimals: 18,
-					Token1Decimals: 6,
+					Token1Decimals: 18,
 					Address:        "0xFe4fe5B4575c036aC6D5cCcFe13660020270e27A",
 					Token0Contract: "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82",
 					Token1Contract: "0x55d398326f99059fF775485246999027B3197955",
@@ -114,7 +147,7 @@ var ChainConfigs = map[string]*NetworkConfig{
 				"USDT/WBNB": {
 					Token0:         "USDT",
 					Token1:         "WBNB",
-					Token0Decimals: 6,
+					Token0Decimals: 18,
 					Token1Decimals: 18,
 					Address:        "0x172fcD41E0913e95784454622d1c3724f546f849",
 				},
@@ -122,7 +155,7 @@ var ChainConfigs = map[string]*NetworkConfig{
 					Token0:         "CAKE",
 					Token1:         "USDT",
 					Token0Decimals: 18,
-					Token1Decimals: 6,
+					Token1Decimals: 18,
 					Address:        "0x7f51c8AaA6B0599aBd16674e2b17FEc7a9f674A1",
 					Token0Contract: "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82",
 					Token1Contract: "0x55d398326f99059fF775485246999027B3197955",
@@ -152,22 +185,28 @@ var ChainConfigs = map[string]*NetworkConfig{
 	},
 }
 
-// GetActiveMarkets returns the pool configuration for the given symbol and dex
-// based on the currently active blockchain network
-func GetActiveMarkets(symbol string, dex DexApp) (*PoolConfig, error) {
-
-	// Get the chain configuration
-	chainConfig, exists := ChainConfigs[blockchain.ActiveChain.ChainName]
+// activeNetworkPools returns the pool configurations of every dex on the
+// currently active blockchain network
+func activeNetworkPools() (map[DexApp]map[string]*PoolConfig, error) {
+	chainConfig, exists := activeRegistry()[blockchain.ActiveChain.ChainName]
 	if !exists {
 		return nil, fmt.Errorf("chain configuration not found for: %s", blockchain.ActiveChain.ChainName)
 	}
 
-	// Select the appropriate network map
-	var networkMap map[DexApp]map[string]*PoolConfig
 	if blockchain.ActiveChain.Network == blockchain.Mainnet {
-		networkMap = chainConfig.Mainnet
-	} else {
-		networkMap = chainConfig.Testnet
+		return chainConfig.Mainnet, nil
+	}
+	return chainConfig.Testnet, nil
+}
+
+// GetActiveMarkets returns the pool configuration for the given symbol and dex
+// based on the currently active blockchain network
+func GetActiveMarkets(symbol string, dex DexApp) (*PoolConfig, error) {
+
+	// Get the network configuration
+	networkMap, err := activeNetworkPools()
+	if err != nil {
+		return nil, err
 	}
 
 	// Get the dex configuration
@@ -186,3 +225,120 @@ func GetActiveMarkets(symbol string, dex DexApp) (*PoolConfig, error) {
 
 	return poolConfig, nil
 }
+
+// TradingContracts lists the routers, pools and tokens the active network
+// trades through, including the wrapped native token. Token contracts are only
+// known once ValidatePoolConfigs has filled them in.
+func TradingContracts() (routers, pools, tokens []common.Address, err error) {
+	networkMap, err := activeNetworkPools()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for app, dexPools := range networkMap {
+		router, err := routerFor(app)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		routers = append(routers, common.HexToAddress(router))
+		for _, config := range dexPools {
+			pools = append(pools, common.HexToAddress(config.Address))
+			for _, token := range []string{config.Token0Contract, config.Token1Contract} {
+				if token != "" {
+					tokens = append(tokens, common.HexToAddress(token))
+				}
+			}
+		}
+	}
+	if wrapped := blockchain.ActiveChain.WrappedNative; wrapped != "" {
+		tokens = append(tokens, common.HexToAddress(wrapped))
+	}
+	return routers, pools, tokens, nil
+}
+
+// Token is one side of a trading symbol.
+type Token struct {
+	Symbol   string
+	Contract common.Address
+	Decimals int
+}
+
+// SymbolTokens returns the base (token0) and quote (token1) token of symbol
+// on the active network. Token contracts are only known once
+// ValidatePoolConfigs has filled them in.
+func SymbolTokens(symbol string) (base, quote Token, err error) {
+	networkMap, err := activeNetworkPools()
+	if err != nil {
+		return Token{}, Token{}, err
+	}
+	apps := make([]DexApp, 0, len(networkMap))
+	for app := range networkMap {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i] < apps[j] })
+
+	for _, app := range apps {
+		config, exists := networkMap[app][symbol]
+		if !exists || config.Token0Contract == "" || config.Token1Contract == "" {
+			continue
+		}
+		base = Token{Symbol: config.Token0, Contract: common.HexToAddress(config.Token0Contract), Decimals: config.Token0Decimals}
+		quote = Token{Symbol: config.Token1, Contract: common.HexToAddress(config.Token1Contract), Decimals: config.Token1Decimals}
+		return base, quote, nil
+	}
+	return Token{}, Token{}, fmt.Errorf("token contracts of %s are unknown, run ValidatePoolConfigs first", symbol)
+}
+
+// LoadPoolFees reads fee() from every pool configured on the active network
+// and stores the tier in its PoolConfig. It must run before trading starts.
+func LoadPoolFees(ctx context.Context, cl *blockchain.Client) error {
+	networkMap, err := activeNetworkPools()
+	if err != nil {
+		return err
+	}
+
+	for app, pools := range networkMap {
+		for symbol, config := range pools {
+			fee, err := readPoolFee(ctx, cl, app, common.HexToAddress(config.Address))
+			if err != nil {
+				return fmt.Errorf("failed to read fee for %s on %s: %w", symbol, app, err)
+			}
+			config.Fee = fee
+			slog.Info("Loaded pool fee", "dex", app, "symbol", symbol, "address", config.Address, "fee", fee)
+		}
+	}
+	return nil
+}
+
+func readPoolFee(ctx context.Context, cl *blockchain.Client, app DexApp, poolAddress common.Address) (uint32, error) {
+	var fee *big.Int
+	switch app {
+	case Pancakeswap:
+		pool, err := contracts.NewPancakeswapV3Pool(poolAddress, cl)
+		if err != nil {
+			return 0, err
+		}
+		if fee, err = pool.Fee(&bind.CallOpts{Context: ctx}); err != nil {
+			return 0, err
+		}
+	default:
+		pool, err := contracts.NewUniswapV3Pool(poolAddress, cl)
+		if err != nil {
+			return 0, err
+		}
+		if fee, err = pool.Fee(&bind.CallOpts{Context: ctx}); err != nil {
+			return 0, err
+		}
+	}
+	return uint32(fee.Uint64()), nil
+}
+
+// feeRatio converts a fee tier into a fraction of the swapped amount,
+// falling back to defaultTier when the tier has not been loaded.
+func feeRatio(config *PoolConfig, defaultTier uint32) float64 {
+	tier := defaultTier
+	if config != nil && config.Fee != 0 {
+		tier = config.Fee
+	}
+	return float64(tier) / 1_000_000
+}
@@ -0,0 +1,175 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// DefaultPriceBuffer is how many prices a subscriber may fall behind before
+// the oldest are dropped.
+const DefaultPriceBuffer = 64
+
+// PriceFeeds fans the prices of each symbol's pool out to any number of
+// subscribers. A pool is watched while it has at least one subscriber. It is
+// safe for concurrent use.
+type PriceFeeds struct {
+	buffer int
+
+	mu    sync.Mutex
+	feeds map[string]*priceFeed
+}
+
+// priceFeed is the watch of one symbol's pool and its subscribers.
+type priceFeed struct {
+	symbol string
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	subscribers map[*PriceSubscription]struct{}
+}
+
+// NewPriceFeeds returns a registry whose subscribers buffer up to buffer
+// prices each.
+func NewPriceFeeds(buffer int) *PriceFeeds {
+	if buffer <= 0 {
+		buffer = DefaultPriceBuffer
+	}
+	return &PriceFeeds{buffer: buffer, feeds: make(map[string]*priceFeed)}
+}
+
+// Subscribe adds a subscriber to symbol's prices until it unsubscribes or ctx
+// is cancelled. When symbol has no subscriber yet, start is called to watch
+// the pool: it must publish every price from a goroutine that stops once its
+// ctx is cancelled, which happens when the last subscriber leaves.
+func (f *PriceFeeds) Subscribe(ctx context.Context, symbol string, start func(ctx context.Context, publish func(*Price)) error) (*PriceSubscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	feed, ok := f.feeds[symbol]
+	if !ok {
+		feedCtx, cancel := context.WithCancel(context.Background())
+		feed = &priceFeed{symbol: symbol, cancel: cancel, subscribers: make(map[*PriceSubscription]struct{})}
+		if err := start(feedCtx, feed.publish); err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to watch %s: %w", symbol, err)
+		}
+		f.feeds[symbol] = feed
+	}
+
+	sub := &PriceSubscription{prices: make(chan *Price, f.buffer)}
+	sub.leave = func() { f.unsubscribe(feed, sub) }
+	feed.mu.Lock()
+	feed.subscribers[sub] = struct{}{}
+	feed.mu.Unlock()
+	// AfterFunc runs Unsubscribe right away when ctx is already cancelled,
+	// possibly before stopOnCancel is stored.
+	stop := context.AfterFunc(ctx, sub.Unsubscribe)
+	sub.mu.Lock()
+	sub.stopOnCancel = stop
+	sub.mu.Unlock()
+	return sub, nil
+}
+
+// Subscribers returns how many subscribers symbol's prices have.
+func (f *PriceFeeds) Subscribers(symbol string) int {
+	f.mu.Lock()
+	feed, ok := f.feeds[symbol]
+	f.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	return len(feed.subscribers)
+}
+
+func (f *PriceFeeds) unsubscribe(feed *priceFeed, sub *PriceSubscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	feed.mu.Lock()
+	delete(feed.subscribers, sub)
+	empty := len(feed.subscribers) == 0
+	feed.mu.Unlock()
+
+	if empty && f.feeds[feed.symbol] == feed {
+		delete(f.feeds, feed.symbol)
+		feed.cancel()
+		slog.Info("Stopped watching pool without subscribers", "symbol", feed.symbol)
+	}
+}
+
+func (f *priceFeed) publish(price *Price) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subscribers {
+		sub.send(price)
+	}
+}
+
+// PriceSubscription is one subscriber's stream of a pool's prices.
+type PriceSubscription struct {
+	prices       chan *Price
+	leave        func()
+	stopOnCancel func() bool
+	once         sync.Once
+
+	mu      sync.Mutex
+	closed  bool
+	dropped uint64
+}
+
+// Prices returns the subscriber's channel. It is closed on Unsubscribe.
+func (s *PriceSubscription) Prices() <-chan *Price {
+	return s.prices
+}
+
+// Unsubscribe stops the subscription and closes its channel. It is safe to
+// call more than once.
+func (s *PriceSubscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.mu.Lock()
+		stop := s.stopOnCancel
+		s.mu.Unlock()
+		if stop != nil {
+			stop()
+		}
+		s.leave()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		close(s.prices)
+	})
+}
+
+// Dropped returns how many prices were discarded because the subscriber fell
+// a full buffer behind.
+func (s *PriceSubscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// send queues price without blocking the feed, discarding the oldest queued
+// price when the buffer is full since only the latest prices matter.
+func (s *PriceSubscription) send(price *Price) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	for {
+		select {
+		case s.prices <- price:
+			return
+		default:
+		}
+		select {
+		case <-s.prices:
+			s.dropped++
+		default:
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package dex
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// stubPool records the watches started by PriceFeeds and lets the test
+// publish prices into the running one.
+type stubPool struct {
+	starts  int
+	publish func(*Price)
+	ctx     context.Context
+}
+
+func (s *stubPool) start(ctx context.Context, publish func(*Price)) error {
+	s.starts++
+	s.ctx = ctx
+	s.publish = publish
+	return nil
+}
+
+func receivePrice(t *testing.T, prices <-chan *Price) *Price {
+	t.Helper()
+	select {
+	case price := <-prices:
+		return price
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for a price")
+		return nil
+	}
+}
+
+func TestPriceFeeds_FansOutToEverySubscriber(t *testing.T) {
+	// Arrange
+	feeds := NewPriceFeeds(4)
+	pool := &stubPool{}
+	first, err := feeds.Subscribe(context.Background(), "WBNB/USDT", pool.start)
+	if err != nil {
+		t.Fatalf("Expected to subscribe, got %v", err)
+	}
+	second, err := feeds.Subscribe(context.Background(), "WBNB/USDT", pool.start)
+	if err != nil {
+		t.Fatalf("Expected to subscribe, got %v", err)
+	}
+
+	// Act
+	pool.publish(&Price{Price: 600})
+
+	// Assert
+	if pool.starts != 1 {
+		t.Errorf("Expected the pool to be watched once, got %d", pool.starts)
+	}
+	if price := receivePrice(t, first.Prices()); price.Price != 600 {
+		t.Errorf("Expected the first subscriber to get 600, got %v", price.Price)
+	}
+	if price := receivePrice(t, second.Prices()); price.Price != 600 {
+		t.Errorf("Expected the second subscriber to get 600, got %v", price.Price)
+	}
+}
+
+func TestPriceFeeds_DropsOldestPricesOfSlowSubscriber(t *testing.T) {
+	// Arrange
+	feeds := NewPriceFeeds(2)
+	pool := &stubPool{}
+	sub, _ := feeds.Subscribe(context.Background(), "WBNB/USDT", pool.start)
+
+	// Act
+	for i := range 5 {
+		pool.publish(&Price{Price: float64(i)})
+	}
+
+	// Assert
+	if dropped := sub.Dropped(); dropped != 3 {
+		t.Errorf("Expected 3 dropped prices, got %d", dropped)
+	}
+	for _, expected := range []float64{3, 4} {
+		if price := receivePrice(t, sub.Prices()); price.Price != expected {
+			t.Errorf("Expected price %v, got %v", expected, price.Price)
+		}
+	}
+}
+
+func TestPriceFeeds_StopsWatchingAfterLastUnsubscribe(t *testing.T) {
+	// Arrange
+	feeds := NewPriceFeeds(4)
+	pool := &stubPool{}
+	ctx, cancel := context.WithCancel(context.Background())
+	first, _ := feeds.Subscribe(ctx, "WBNB/USDT", pool.start)
+	second, _ := feeds.Subscribe(context.Background(), "WBNB/USDT", pool.start)
+
+	// Act
+	cancel()
+
+	// Assert
+	select {
+	case _, open := <-first.Prices():
+		if open {
+			t.Fatalf("Expected no price on the cancelled subscription")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the cancelled subscription to close")
+	}
+	if pool.ctx.Err() != nil {
+		t.Errorf("Expected the pool to stay watched for the second subscriber")
+	}
+	pool.publish(&Price{Price: 600})
+	if price := receivePrice(t, second.Prices()); price.Price != 600 {
+		t.Errorf("Expected the remaining subscriber to get 600, got %v", price.Price)
+	}
+
+	second.Unsubscribe()
+	second.Unsubscribe()
+	if pool.ctx.Err() == nil {
+		t.Errorf("Expected the pool watch to stop without subscribers")
+	}
+	if n := feeds.Subscribers("WBNB/USDT"); n != 0 {
+		t.Errorf("Expected no subscribers, got %d", n)
+	}
+	pool.publish(&Price{Price: 601})
+}
+
+func TestPriceFeeds_SubscribeWithCancelledContext(t *testing.T) {
+	// Arrange
+	feeds := NewPriceFeeds(4)
+	pool := &stubPool{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	sub, err := feeds.Subscribe(ctx, "WBNB/USDT", pool.start)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected to subscribe, got %v", err)
+	}
+	select {
+	case _, open := <-sub.Prices():
+		if open {
+			t.Fatalf("Expected no price on the cancelled subscription")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the cancelled subscription to close")
+	}
+	sub.Unsubscribe()
+	if n := feeds.Subscribers("WBNB/USDT"); n != 0 {
+		t.Errorf("Expected no subscribers, got %d", n)
+	}
+}
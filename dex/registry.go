@@ -0,0 +1,195 @@
+package dex
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+// RegistryFile is the on-disk layout of the pool registry:
+// chain → network ("mainnet"/"testnet") → DexApp → symbol → pool.
+//
+//	{
+//	  "BSC": {
+//	    "mainnet": {
+//	      "Pancakeswap": {
+//	        "CAKE/USDT": {
+//	          "token0": "CAKE", "token1": "USDT",
+//	          "token0Decimals": 18, "token1Decimals": 18,
+//	          "address": "0x7f51c8AaA6B0599aBd16674e2b17FEc7a9f674A1"
+//	        }
+//	      }
+//	    }
+//	  }
+//	}
+type RegistryFile map[string]map[string]map[DexApp]map[string]*PoolConfig
+
+var (
+	registryMu sync.RWMutex
+	registry   = ChainConfigs
+)
+
+// activeRegistry returns the registry GetActiveMarkets reads from.
+func activeRegistry() map[string]*NetworkConfig {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry
+}
+
+// LoadRegistry reads the pool registry from a JSON file and makes it the
+// active registry. With mergeDefaults the file's pools are laid over the
+// built-in ChainConfigs, otherwise the file replaces them entirely.
+func LoadRegistry(path string, mergeDefaults bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read pool registry: %w", err)
+	}
+
+	loaded, err := ParseRegistry(data)
+	if err != nil {
+		return fmt.Errorf("invalid pool registry %s: %w", path, err)
+	}
+
+	if mergeDefaults {
+		loaded = mergeRegistries(ChainConfigs, loaded)
+	}
+
+	registryMu.Lock()
+	registry = loaded
+	registryMu.Unlock()
+
+	slog.Info("Loaded pool registry", "path", path, "mergedDefaults", mergeDefaults, "chains", len(loaded))
+	return nil
+}
+
+// ParseRegistry decodes and validates a registry file. Every problem found is
+// reported, each prefixed with the path of the offending entry.
+func ParseRegistry(data []byte) (map[string]*NetworkConfig, error) {
+	var file RegistryFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode: %w", err)
+	}
+
+	var errs []error
+	result := make(map[string]*NetworkConfig, len(file))
+	for chain, networks := range file {
+		networkConfig := &NetworkConfig{}
+		for network, dexes := range networks {
+			path := chain + "." + network
+			for app, pools := range dexes {
+				if _, known := FeeTiers[app]; !known {
+					errs = append(errs, fmt.Errorf("%s: unknown dex %q", path, app))
+				}
+				for symbol, pool := range pools {
+					errs = append(errs, validateRegistryPool(fmt.Sprintf("%s.%s[%q]", path, app, symbol), app, symbol, pool)...)
+				}
+			}
+
+			switch network {
+			case blockchain.Mainnet:
+				networkConfig.Mainnet = dexes
+			case blockchain.Testnet:
+				networkConfig.Testnet = dexes
+			default:
+				errs = append(errs, fmt.Errorf("%s: network must be %q or %q", path, blockchain.Mainnet, blockchain.Testnet))
+			}
+		}
+		result[chain] = networkConfig
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return result, nil
+}
+
+func validateRegistryPool(path string, app DexApp, symbol string, pool *PoolConfig) []error {
+	if pool == nil {
+		return []error{fmt.Errorf("%s: pool is empty", path)}
+	}
+
+	var errs []error
+	if parts := strings.Split(symbol, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		errs = append(errs, fmt.Errorf("%s: symbol must look like TOKEN0/TOKEN1", path))
+	} else {
+		// token0/token1 default to the symbol's halves
+		if pool.Token0 == "" {
+			pool.Token0 = parts[0]
+		}
+		if pool.Token1 == "" {
+			pool.Token1 = parts[1]
+		}
+		if parts[0] != pool.Token0 || parts[1] != pool.Token1 {
+			errs = append(errs, fmt.Errorf("%s: token0/token1 %s/%s do not match the symbol", path, pool.Token0, pool.Token1))
+		}
+	}
+	if !common.IsHexAddress(pool.Address) {
+		errs = append(errs, fmt.Errorf("%s.address: %q is not an address", path, pool.Address))
+	}
+	if pool.Token0Contract != "" && !common.IsHexAddress(pool.Token0Contract) {
+		errs = append(errs, fmt.Errorf("%s.token0Contract: %q is not an address", path, pool.Token0Contract))
+	}
+	if pool.Token1Contract != "" && !common.IsHexAddress(pool.Token1Contract) {
+		errs = append(errs, fmt.Errorf("%s.token1Contract: %q is not an address", path, pool.Token1Contract))
+	}
+	if pool.Token0Decimals < 0 || pool.Token0Decimals > 36 {
+		errs = append(errs, fmt.Errorf("%s.token0Decimals: %d is out of range", path, pool.Token0Decimals))
+	}
+	if pool.Token1Decimals < 0 || pool.Token1Decimals > 36 {
+		errs = append(errs, fmt.Errorf("%s.token1Decimals: %d is out of range", path, pool.Token1Decimals))
+	}
+	if tiers, known := FeeTiers[app]; known && pool.Fee != 0 && !slices.Contains(tiers, pool.Fee) {
+		errs = append(errs, fmt.Errorf("%s.fee: %d is not a %s fee tier %v", path, pool.Fee, app, tiers))
+	}
+	return errs
+}
+
+// mergeRegistries returns a copy of base with every pool from overlay added
+// or replacing the pool of the same chain, network, dex and symbol.
+func mergeRegistries(base, overlay map[string]*NetworkConfig) map[string]*NetworkConfig {
+	merged := make(map[string]*NetworkConfig, len(base))
+	for chain, networkConfig := range base {
+		merged[chain] = &NetworkConfig{
+			Mainnet: copyDexPools(networkConfig.Mainnet, nil),
+			Testnet: copyDexPools(networkConfig.Testnet, nil),
+		}
+	}
+
+	for chain, networkConfig := range overlay {
+		existing, exists := merged[chain]
+		if !exists {
+			existing = &NetworkConfig{}
+			merged[chain] = existing
+		}
+		existing.Mainnet = copyDexPools(existing.Mainnet, networkConfig.Mainnet)
+		existing.Testnet = copyDexPools(existing.Testnet, networkConfig.Testnet)
+	}
+	return merged
+}
+
+func copyDexPools(base, overlay map[DexApp]map[string]*PoolConfig) map[DexApp]map[string]*PoolConfig {
+	result := make(map[DexApp]map[string]*PoolConfig)
+	for _, source := range []map[DexApp]map[string]*PoolConfig{base, overlay} {
+		for app, pools := range source {
+			if result[app] == nil {
+				result[app] = make(map[string]*PoolConfig)
+			}
+			for symbol, pool := range pools {
+				poolCopy := *pool
+				result[app][symbol] = &poolCopy
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+package dex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRegistry_ExampleFile(t *testing.T) {
+	// Arrange
+	data, err := os.ReadFile(filepath.Join("..", "pools.example.json"))
+	if err != nil {
+		t.Fatalf("Failed to read example registry: %v", err)
+	}
+
+	// Act
+	registry, err := ParseRegistry(data)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected example registry to be valid, got %v", err)
+	}
+	pool := registry["BSC"].Mainnet[Pancakeswap]["CAKE/USDT"]
+	if pool == nil || pool.Address != "0x7f51c8AaA6B0599aBd16674e2b17FEc7a9f674A1" {
+		t.Errorf("Expected Pancakeswap CAKE/USDT pool to be loaded, got %+v", pool)
+	}
+}
+
+func TestParseRegistry_ReportsEveryError(t *testing.T) {
+	// Arrange
+	data := []byte(`{
+		"BSC": {
+			"mainnet": {
+				"Sushiswap": {},
+				"Uniswap": {
+					"CAKE/USDT": {"token0Decimals": 18, "token1Decimals": 99, "address": "0x123", "fee": 1234}
+				}
+			},
+			"devnet": {}
+		}
+	}`)
+
+	// Act
+	_, err := ParseRegistry(data)
+
+	// Assert
+	if err == nil {
+		t.Fatal("Expected registry to be rejected")
+	}
+	for _, want := range []string{`unknown dex "Sushiswap"`, "address", "token1Decimals", "fee", "devnet"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestParseRegistry_RejectsUnknownFields(t *testing.T) {
+	// Act
+	_, err := ParseRegistry([]byte(`{"BSC": {"mainnet": {"Uniswap": {"A/B": {"adress": "0x0"}}}}}`))
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "adress") {
+		t.Errorf("Expected unknown field error, got %v", err)
+	}
+}
+
+func TestMergeRegistries_OverlaysDefaults(t *testing.T) {
+	// Arrange
+	overlay, err := ParseRegistry([]byte(`{"BSC": {"mainnet": {"Uniswap": {"ETH/USDT": {
+		"token0Decimals": 18, "token1Decimals": 18, "address": "0xBe141893E4c6AD9272e8C04BAB7E6a10604501a5"}}}}}`))
+	if err != nil {
+		t.Fatalf("Failed to parse overlay: %v", err)
+	}
+
+	// Act
+	merged := mergeRegistries(ChainConfigs, overlay)
+
+	// Assert
+	if merged["BSC"].Mainnet[Uniswap]["ETH/USDT"] == nil {
+		t.Error("Expected overlay pool to be added")
+	}
+	if merged["BSC"].Mainnet[Uniswap]["CAKE/USDT"] == nil {
+		t.Error("Expected default pool to be kept")
+	}
+	if merged["BSC"].Mainnet[Uniswap]["CAKE/USDT"] == ChainConfigs["BSC"].Mainnet[Uniswap]["CAKE/USDT"] {
+		t.Error("Expected merged registry not to share pools with the defaults")
+	}
+}
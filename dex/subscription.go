@@ -0,0 +1,349 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+// Resubscription backoff bounds. The delay doubles after every failed attempt
+// and starts over once a subscription is established.
+var (
+	minResubscribeDelay = 500 * time.Millisecond
+	maxResubscribeDelay = 30 * time.Second
+)
+
+// maxBackfillBlocks caps how far back missed events are fetched after a
+// reconnect; older events no longer matter for the current price.
+const maxBackfillBlocks = 5000
+
+// swapStream describes how to watch and backfill the Swap events of one pool.
+type swapStream[E any] struct {
+	name   string
+	watch  func(opts *bind.WatchOpts, sink chan<- E) (event.Subscription, error)
+	filter func(opts *bind.FilterOpts) ([]E, error)
+	log    func(E) types.Log
+	// rollback re-sends the pool's price as of block after the swaps of the
+	// blocks above it were reorged out.
+	rollback func(block uint64)
+	// polling is used when the events cannot be subscribed to.
+	polling logPolling
+}
+
+// logPolling sets how often logs are polled for and how many blocks one
+// eth_getLogs call may span. After failures subscribe attempts in a row fail,
+// logs are polled for retry before subscribing is tried again; zero failures
+// keeps resubscribing instead.
+type logPolling struct {
+	interval time.Duration
+	maxRange uint64
+	failures int
+	retry    time.Duration
+}
+
+// Polling fallback of an unreachable websocket: after subscribeFailures
+// failed attempts in a row, logs are polled for websocketRetry.
+const (
+	subscribeFailures = 3
+	websocketRetry    = time.Minute
+)
+
+// activePolling returns the polling settings of the active network.
+func activePolling() logPolling {
+	polling := logPolling{interval: time.Second, maxRange: blockchain.DefaultMaxLogRange, failures: subscribeFailures, retry: websocketRetry}
+	if blockchain.ActiveChain != nil {
+		polling.interval = blockchain.ActiveChain.LogPollInterval()
+		polling.maxRange = blockchain.ActiveChain.LogRange()
+	}
+	return polling
+}
+
+// headReader reads the chain head; *blockchain.Client implements it.
+type headReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// maxPolledHeads is how many polled heads are remembered to find where a
+// reorg forked off. A reorg deeper than that rewinds to the oldest of them.
+const maxPolledHeads = 64
+
+// logPosition orders events across subscriptions and backfills.
+// lastIndex marks a position after every log of its block.
+type logPosition struct {
+	block uint64
+	index uint
+}
+
+const lastIndex = ^uint(0)
+
+func (p logPosition) after(other logPosition) bool {
+	return p.block > other.block || (p.block == other.block && p.index > other.index)
+}
+
+// streamSwaps calls handle for every Swap event of the stream, in order and
+// at most once. When the subscription fails, the websocket is re-dialled by
+// resubscribing with exponential backoff, and events emitted while it was
+// down are backfilled from the last block seen. Without websocket support the
+// events are polled for over HTTP instead, and while subscribing keeps
+// failing they are polled for until the websocket is tried again. It returns
+// once ctx is cancelled.
+//
+// A log delivered again as removed by a reorg rewinds the stream to the block
+// before it, so the events that replace it are delivered, and the stream's
+// rollback restores the price of that canonical block. While polling, a
+// polled head that changed hash rewinds the stream the same way.
+func streamSwaps[E any](ctx context.Context, cl headReader, stream swapStream[E], handle func(E)) {
+	var last logPosition
+	// rewind forgets the events delivered after block, so they are delivered
+	// again, and restores the price of block.
+	rewind := func(block uint64) {
+		position := logPosition{block: block, index: lastIndex}
+		if last.block == 0 || !last.after(position) {
+			// Nothing delivered after block.
+			return
+		}
+		last = position
+		if stream.rollback != nil {
+			stream.rollback(block)
+		}
+	}
+	deliver := func(swap E) {
+		log := stream.log(swap)
+		position := logPosition{block: log.BlockNumber, index: log.Index}
+		if log.Removed {
+			if last.block == 0 || position.after(last) || log.BlockNumber == 0 {
+				// Not delivered, or already rolled back past it.
+				return
+			}
+			slog.Warn("Swap event reorged out, rolling back", "pool", stream.name, "block", log.BlockNumber, "index", log.Index, "tx", log.TxHash.Hex())
+			rewind(log.BlockNumber - 1)
+			return
+		}
+		if last.block != 0 && !position.after(last) {
+			return
+		}
+		last = position
+		handle(swap)
+	}
+
+	delay := minResubscribeDelay
+	failures := 0
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			slog.Info("Resubscribing to swap events", "pool", stream.name, "attempt", attempt, "delay", delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxResubscribeDelay)
+		}
+
+		swaps := make(chan E)
+		sub, err := stream.watch(&bind.WatchOpts{Context: ctx}, swaps)
+		if errors.Is(err, blockchain.ErrNoWebsocket) || errors.Is(err, rpc.ErrNotificationsUnsupported) {
+			slog.Warn("Swap events cannot be subscribed to, polling instead", "pool", stream.name, "error", err)
+			pollSwaps(ctx, cl, stream, deliver, rewind, last.block)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to subscribe to swap events", "pool", stream.name, "error", err)
+			if failures++; stream.polling.failures > 0 && failures >= stream.polling.failures {
+				slog.Warn("Swap subscription keeps failing, polling until the websocket is retried",
+					"pool", stream.name, "failures", failures, "retryIn", stream.polling.retry)
+				pollCtx, cancel := context.WithTimeout(ctx, stream.polling.retry)
+				pollSwaps(pollCtx, cl, stream, deliver, rewind, last.block)
+				cancel()
+				if ctx.Err() != nil {
+					return
+				}
+				failures = 0
+				delay = minResubscribeDelay
+			}
+			continue
+		}
+		failures = 0
+
+		if last.block != 0 {
+			missed, err := backfillSwaps(ctx, cl, stream, last.block)
+			if err != nil {
+				slog.Error("Failed to backfill swap events", "pool", stream.name, "error", err)
+				sub.Unsubscribe()
+				continue
+			}
+			for _, swap := range missed {
+				deliver(swap)
+			}
+		}
+		delay = minResubscribeDelay
+
+		err = consumeSwaps(ctx, sub, swaps, deliver)
+		if ctx.Err() != nil {
+			slog.Info("Stopped watching swap events", "pool", stream.name)
+			return
+		}
+		slog.Error("Swap subscription dropped", "pool", stream.name, "error", err)
+	}
+}
+
+// consumeSwaps delivers events until the subscription fails or ctx is
+// cancelled, and unsubscribes.
+func consumeSwaps[E any](ctx context.Context, sub event.Subscription, swaps <-chan E, deliver func(E)) error {
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case swap := <-swaps:
+			deliver(swap)
+		}
+	}
+}
+
+// backfillSwaps fetches the events from the last seen block up to the head.
+// The last seen block is included since it may have had more events after
+// the last one delivered.
+func backfillSwaps[E any](ctx context.Context, cl headReader, stream swapStream[E], from uint64) ([]E, error) {
+	head, err := cl.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read head block: %w", err)
+	}
+	if head > maxBackfillBlocks && from < head-maxBackfillBlocks {
+		slog.Warn("Swap events missed beyond the backfill window", "pool", stream.name, "lastSeen", from, "head", head)
+		from = head - maxBackfillBlocks
+	}
+	swaps, err := filterSwaps(ctx, stream, from, head)
+	if err != nil {
+		return nil, err
+	}
+	if len(swaps) > 0 {
+		slog.Info("Backfilled swap events", "pool", stream.name, "from", from, "to", head, "count", len(swaps))
+	}
+	return swaps, nil
+}
+
+// pollSwaps watches the head block over HTTP and fetches the events of every
+// new range of blocks, starting at from or at the current head when from is
+// zero. When a polled head is no longer canonical, the stream is rewound to
+// the newest polled head that still is and its events are fetched again. It
+// returns once ctx is cancelled.
+func pollSwaps[E any](ctx context.Context, cl headReader, stream swapStream[E], deliver func(E), rewind func(block uint64), from uint64) {
+	ticker := time.NewTicker(stream.polling.interval)
+	defer ticker.Stop()
+
+	slog.Info("Polling swap events", "pool", stream.name, "interval", stream.polling.interval)
+	next := from
+	var polled []polledHead
+	poll := func() {
+		header, err := cl.HeaderByNumber(ctx, nil)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to read head block", "pool", stream.name, "error", err)
+			}
+			return
+		}
+		head := header.Number.Uint64()
+
+		fork, reorged, err := findFork(ctx, cl, polled)
+		if err != nil {
+			slog.Error("Failed to check polled blocks for a reorg", "pool", stream.name, "error", err)
+			return
+		}
+		if reorged {
+			slog.Warn("Polled blocks reorged out, rolling back", "pool", stream.name, "block", fork, "head", head)
+			for len(polled) > 0 && polled[len(polled)-1].number > fork {
+				polled = polled[:len(polled)-1]
+			}
+			rewind(fork)
+			next = fork + 1
+		}
+
+		if next == 0 {
+			next = head
+		}
+		if head < next {
+			return
+		}
+		swaps, err := filterSwaps(ctx, stream, next, head)
+		if err != nil {
+			// The range is fetched again on the next tick.
+			slog.Error("Failed to poll swap events", "pool", stream.name, "from", next, "to", head, "error", err)
+			return
+		}
+		for _, swap := range swaps {
+			deliver(swap)
+		}
+		next = head + 1
+		if polled = append(polled, polledHead{number: head, hash: header.Hash()}); len(polled) > maxPolledHeads {
+			polled = polled[1:]
+		}
+	}
+	for {
+		poll()
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped polling swap events", "pool", stream.name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// polledHead is a head block pollSwaps fetched the events up to.
+type polledHead struct {
+	number uint64
+	hash   common.Hash
+}
+
+// findFork reports whether the newest polled head was reorged out and, if so,
+// the newest polled block still canonical, which the events are fetched again
+// from. polled is ordered oldest first.
+func findFork(ctx context.Context, cl headReader, polled []polledHead) (fork uint64, reorged bool, err error) {
+	for i := len(polled) - 1; i >= 0; i-- {
+		header, err := cl.HeaderByNumber(ctx, new(big.Int).SetUint64(polled[i].number))
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to read block %d: %w", polled[i].number, err)
+		}
+		if header.Hash() == polled[i].hash {
+			return polled[i].number, i < len(polled)-1, nil
+		}
+	}
+	if len(polled) == 0 {
+		return 0, false, nil
+	}
+	// Forked off below every remembered head.
+	return polled[0].number - 1, true, nil
+}
+
+// filterSwaps fetches the events from block from to block to, both included,
+// in ranges no longer than the network's log range limit.
+func filterSwaps[E any](ctx context.Context, stream swapStream[E], from, to uint64) ([]E, error) {
+	maxRange := stream.polling.maxRange
+	if maxRange == 0 {
+		maxRange = blockchain.DefaultMaxLogRange
+	}
+
+	var swaps []E
+	for start := from; start <= to; start += maxRange {
+		end := min(start+maxRange-1, to)
+		found, err := stream.filter(&bind.FilterOpts{Start: start, End: &end, Context: ctx})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch swap events of blocks %d-%d: %w", start, end, err)
+		}
+		swaps = append(swaps, found...)
+	}
+	return swaps, nil
+}
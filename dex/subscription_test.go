@@ -0,0 +1,384 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+type fixedHead uint64
+
+func (h fixedHead) BlockNumber(ctx context.Context) (uint64, error) {
+	return uint64(h), nil
+}
+
+func (h fixedHead) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		number = new(big.Int).SetUint64(uint64(h))
+	}
+	return &types.Header{Number: number}, nil
+}
+
+// advancingHead moves the head forward by step blocks on every read.
+type advancingHead struct {
+	mu   sync.Mutex
+	head uint64
+	step uint64
+}
+
+func (h *advancingHead) BlockNumber(ctx context.Context) (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.head += h.step
+	return h.head, nil
+}
+
+func (h *advancingHead) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		head, _ := h.BlockNumber(ctx)
+		number = new(big.Int).SetUint64(head)
+	}
+	return &types.Header{Number: number}, nil
+}
+
+// reorgingHead advances one block per head read. Once the head reaches
+// reorgAt, the blocks from forkAt up are replaced: their headers, and the
+// index of their events, carry generation 1.
+type reorgingHead struct {
+	mu      sync.Mutex
+	head    uint64
+	reorgAt uint64
+	forkAt  uint64
+}
+
+func (h *reorgingHead) BlockNumber(ctx context.Context) (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.head, nil
+}
+
+func (h *reorgingHead) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	h.mu.Lock()
+	if number == nil {
+		h.head++
+		number = new(big.Int).SetUint64(h.head)
+	}
+	h.mu.Unlock()
+	return &types.Header{Number: number, Extra: []byte{byte(h.generation(number.Uint64()))}}, nil
+}
+
+func (h *reorgingHead) generation(block uint64) uint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.head >= h.reorgAt && block >= h.forkAt {
+		return 1
+	}
+	return 0
+}
+
+// droppingSubscription sends logs and then fails when drop is set, or stays
+// open otherwise.
+func droppingSubscription(sink chan<- *types.Log, logs []*types.Log, drop bool) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		for _, log := range logs {
+			select {
+			case sink <- log:
+			case <-quit:
+				return nil
+			}
+		}
+		if drop {
+			return errors.New("websocket closed")
+		}
+		<-quit
+		return nil
+	})
+}
+
+func TestStreamSwaps_ResubscribesAndBackfills(t *testing.T) {
+	// Arrange
+	defer func(delay time.Duration) { minResubscribeDelay = delay }(minResubscribeDelay)
+	minResubscribeDelay = time.Millisecond
+	attempts := 0
+	stream := swapStream[*types.Log]{
+		name: "test",
+		watch: func(opts *bind.WatchOpts, sink chan<- *types.Log) (event.Subscription, error) {
+			attempts++
+			switch attempts {
+			case 1:
+				return droppingSubscription(sink, []*types.Log{{BlockNumber: 10, Index: 0}}, true), nil
+			case 2:
+				return nil, errors.New("dial failed")
+			default:
+				return droppingSubscription(sink, []*types.Log{{BlockNumber: 11, Index: 0}, {BlockNumber: 12, Index: 3}}, false), nil
+			}
+		},
+		filter: func(opts *bind.FilterOpts) ([]*types.Log, error) {
+			if opts.Start != 10 {
+				t.Errorf("Expected backfill from block 10, got %d", opts.Start)
+			}
+			return []*types.Log{{BlockNumber: 10, Index: 0}, {BlockNumber: 10, Index: 4}, {BlockNumber: 11, Index: 0}}, nil
+		},
+		log: func(log *types.Log) types.Log { return *log },
+	}
+	delivered := make(chan *types.Log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	go streamSwaps(ctx, fixedHead(12), stream, func(log *types.Log) { delivered <- log })
+
+	// Assert
+	expected := []logPosition{{10, 0}, {10, 4}, {11, 0}, {12, 3}}
+	for _, want := range expected {
+		select {
+		case log := <-delivered:
+			if got := (logPosition{log.BlockNumber, log.Index}); got != want {
+				t.Fatalf("Expected event %v, got %v", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for event %v", want)
+		}
+	}
+	select {
+	case log := <-delivered:
+		t.Errorf("Expected no duplicate events, got block %d index %d", log.BlockNumber, log.Index)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStreamSwaps_PollsWithoutWebsocket(t *testing.T) {
+	// Arrange
+	head := &advancingHead{head: 94, step: 5}
+	var mu sync.Mutex
+	var ranges [][2]uint64
+	stream := swapStream[*types.Log]{
+		name: "test",
+		watch: func(opts *bind.WatchOpts, sink chan<- *types.Log) (event.Subscription, error) {
+			return nil, blockchain.ErrNoWebsocket
+		},
+		filter: func(opts *bind.FilterOpts) ([]*types.Log, error) {
+			mu.Lock()
+			ranges = append(ranges, [2]uint64{opts.Start, *opts.End})
+			mu.Unlock()
+			var logs []*types.Log
+			for block := opts.Start; block <= *opts.End; block++ {
+				logs = append(logs, &types.Log{BlockNumber: block})
+			}
+			return logs, nil
+		},
+		log:     func(log *types.Log) types.Log { return *log },
+		polling: logPolling{interval: time.Millisecond, maxRange: 2},
+	}
+	delivered := make(chan *types.Log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	go streamSwaps(ctx, head, stream, func(log *types.Log) { delivered <- log })
+
+	// Assert
+	for want := uint64(99); want <= 109; want++ {
+		select {
+		case log := <-delivered:
+			if log.BlockNumber != want {
+				t.Fatalf("Expected an event of block %d, got %d", want, log.BlockNumber)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for an event of block %d", want)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range ranges {
+		if r[1]-r[0]+1 > 2 {
+			t.Errorf("Expected ranges of at most 2 blocks, got %d-%d", r[0], r[1])
+		}
+	}
+}
+
+func TestStreamSwaps_PollsWhileSubscribingFails(t *testing.T) {
+	// Arrange
+	defer func(delay time.Duration) { minResubscribeDelay = delay }(minResubscribeDelay)
+	minResubscribeDelay = time.Millisecond
+	var mu sync.Mutex
+	attempts := 0
+	stream := swapStream[*types.Log]{
+		name: "test",
+		watch: func(opts *bind.WatchOpts, sink chan<- *types.Log) (event.Subscription, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			return nil, errors.New("dial tcp: connection refused")
+		},
+		filter: func(opts *bind.FilterOpts) ([]*types.Log, error) {
+			return []*types.Log{{BlockNumber: *opts.End}}, nil
+		},
+		log:     func(log *types.Log) types.Log { return *log },
+		polling: logPolling{interval: time.Millisecond, maxRange: 10, failures: 2, retry: 50 * time.Millisecond},
+	}
+	delivered := make(chan *types.Log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	go streamSwaps(ctx, &advancingHead{head: 99, step: 1}, stream, func(log *types.Log) { delivered <- log })
+
+	// Assert
+	select {
+	case log := <-delivered:
+		if log.BlockNumber < 100 {
+			t.Errorf("Expected a polled event from block 100, got %d", log.BlockNumber)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected events to be polled after subscribing failed")
+	}
+	deadline := time.After(2 * time.Second)
+	for {
+		mu.Lock()
+		retried := attempts > 2
+		mu.Unlock()
+		if retried {
+			return
+		}
+		select {
+		case <-delivered:
+		case <-deadline:
+			t.Fatalf("Expected the websocket to be retried after polling")
+		}
+	}
+}
+
+func TestStreamSwaps_RollsBackReorgedEvents(t *testing.T) {
+	// Arrange
+	logs := []*types.Log{
+		{BlockNumber: 10, Index: 0},
+		{BlockNumber: 11, Index: 2},
+		{BlockNumber: 11, Index: 2, Removed: true},
+		{BlockNumber: 11, Index: 5, Removed: true},
+		{BlockNumber: 11, Index: 1},
+		{BlockNumber: 12, Index: 0},
+	}
+	rollbacks := make(chan uint64, 2)
+	stream := swapStream[*types.Log]{
+		name: "test",
+		watch: func(opts *bind.WatchOpts, sink chan<- *types.Log) (event.Subscription, error) {
+			return droppingSubscription(sink, logs, false), nil
+		},
+		log:      func(log *types.Log) types.Log { return *log },
+		rollback: func(block uint64) { rollbacks <- block },
+	}
+	delivered := make(chan *types.Log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	go streamSwaps(ctx, fixedHead(12), stream, func(log *types.Log) { delivered <- log })
+
+	// Assert
+	expected := []logPosition{{10, 0}, {11, 2}, {11, 1}, {12, 0}}
+	for _, want := range expected {
+		select {
+		case log := <-delivered:
+			if got := (logPosition{log.BlockNumber, log.Index}); got != want || log.Removed {
+				t.Fatalf("Expected event %v, got %v (removed %v)", want, got, log.Removed)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for event %v", want)
+		}
+	}
+	if len(rollbacks) != 1 || <-rollbacks != 10 {
+		t.Errorf("Expected a single rollback to block 10")
+	}
+}
+
+func TestStreamSwaps_RollsBackReorgWhilePolling(t *testing.T) {
+	// Arrange
+	head := &reorgingHead{head: 99, reorgAt: 103, forkAt: 101}
+	rollbacks := make(chan uint64, 2)
+	stream := swapStream[*types.Log]{
+		name: "test",
+		watch: func(opts *bind.WatchOpts, sink chan<- *types.Log) (event.Subscription, error) {
+			return nil, blockchain.ErrNoWebsocket
+		},
+		filter: func(opts *bind.FilterOpts) ([]*types.Log, error) {
+			var logs []*types.Log
+			for block := opts.Start; block <= *opts.End; block++ {
+				logs = append(logs, &types.Log{BlockNumber: block, Index: head.generation(block)})
+			}
+			return logs, nil
+		},
+		log:      func(log *types.Log) types.Log { return *log },
+		rollback: func(block uint64) { rollbacks <- block },
+		polling:  logPolling{interval: time.Millisecond, maxRange: 10},
+	}
+	delivered := make(chan *types.Log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	go streamSwaps(ctx, head, stream, func(log *types.Log) { delivered <- log })
+
+	// Assert
+	expected := []logPosition{{100, 0}, {101, 0}, {102, 0}, {101, 1}, {102, 1}, {103, 1}}
+	for _, want := range expected {
+		select {
+		case log := <-delivered:
+			if got := (logPosition{log.BlockNumber, log.Index}); got != want {
+				t.Fatalf("Expected event %v, got %v", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for event %v", want)
+		}
+	}
+	if len(rollbacks) != 1 || <-rollbacks != 100 {
+		t.Errorf("Expected a single rollback to block 100")
+	}
+}
+
+func TestStreamSwaps_StopsOnCancel(t *testing.T) {
+	// Arrange
+	unsubscribed := make(chan struct{})
+	stream := swapStream[*types.Log]{
+		name: "test",
+		watch: func(opts *bind.WatchOpts, sink chan<- *types.Log) (event.Subscription, error) {
+			return event.NewSubscription(func(quit <-chan struct{}) error {
+				<-quit
+				close(unsubscribed)
+				return nil
+			}), nil
+		},
+		log: func(log *types.Log) types.Log { return *log },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		streamSwaps(ctx, fixedHead(12), stream, func(log *types.Log) {})
+		close(stopped)
+	}()
+
+	// Act
+	cancel()
+
+	// Assert
+	for name, done := range map[string]chan struct{}{"unsubscribe": unsubscribed, "return": stopped} {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected the stream to %s after cancellation", name)
+		}
+	}
+}
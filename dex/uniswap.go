@@ -6,195 +6,344 @@ import (
 	"log/slog"
 	"math/big"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/sagarkarki99/arbitrator/constants"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sagarkarki99/arbitrator/blockchain"
 	"github.com/sagarkarki99/arbitrator/contracts"
 	"github.com/sagarkarki99/arbitrator/keychain"
 )
 
-func NewUniswapV3Pool(cl *ethclient.Client, kc keychain.Keychain) Dex {
+// NewUniswapV3Pool returns the Uniswap adapter. approver is asked for an
+// approval when a swap's input token cannot be permitted; nil fails such
+// swaps instead.
+func NewUniswapV3Pool(cl *blockchain.Client, kc keychain.Keychain, approver Approver) Dex {
 	return &UniswapV3{
-		cl:          cl,
-		sub:         make(map[string]chan *Price),
-		platformFee: 0.003, // 0.3% fee for Uniswap V3
-		kc:          kc,
+		cl:             cl,
+		approver:       approver,
+		feeds:          NewPriceFeeds(DefaultPriceBuffer),
+		clock:          newBlockClock(cl),
+		defaultFeeTier: 3000, // 0.3% tier until LoadPoolFees reads the pool's fee
+		kc:             kc,
+		permitDomains:  make(map[common.Address]*apitypes.TypedDataDomain),
+		permits:        make(map[[2]common.Address]*signedPermit),
 	}
 }
 
 type UniswapV3 struct {
-	cl          *ethclient.Client
-	sub         map[string]chan *Price
-	platformFee float64
-	kc          keychain.Keychain
+	cl             *blockchain.Client
+	feeds          *PriceFeeds
+	clock          *blockClock
+	defaultFeeTier uint32
+	kc             keychain.Keychain
+	// approver is used for input tokens without permit support.
+	approver Approver
+
+	permitMu sync.Mutex
+	// permitDomains caches each token's EIP-712 domain, nil when it has none.
+	permitDomains map[common.Address]*apitypes.TypedDataDomain
+	permits       map[[2]common.Address]*signedPermit
 }
 
-func (u *UniswapV3) GetPrice(symbol string) (<-chan *Price, error) {
-	if u.sub[symbol] != nil {
-		return u.sub[symbol], nil
-	}
+func (u *UniswapV3) GetPrice(ctx context.Context, symbol string) (*PriceSubscription, error) {
+	return u.feeds.Subscribe(ctx, symbol, func(ctx context.Context, publish func(*Price)) error {
+		return u.watchPool(ctx, symbol, publish)
+	})
+}
 
+// watchPool publishes the prices of symbol's pool until ctx is cancelled.
+func (u *UniswapV3) watchPool(ctx context.Context, symbol string, publish func(*Price)) error {
 	config, err := GetActiveMarkets(symbol, Uniswap)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get pool config: %w", err)
+		return fmt.Errorf("failed to get pool config: %w", err)
 	}
 
 	poolAddress := common.HexToAddress(config.Address)
 	pool, err := contracts.NewUniswapV3Pool(poolAddress, u.cl)
 	if err != nil {
 		slog.Error("Could not create uniswapv3pool")
-		return nil, fmt.Errorf("failed to create pool contract: %w", err)
+		return fmt.Errorf("failed to create pool contract: %w", err)
 	}
 
-	swapChan := make(chan *contracts.UniswapV3PoolSwap)
-	priceChan := make(chan *Price)
+	slog.Info("Subscribing to Uniswap V3 pool", "symbol", symbol, "address", poolAddress.Hex())
 
-	sub, err := pool.WatchSwap(&bind.WatchOpts{}, swapChan, nil, nil)
-
-	if err != nil {
-		slog.Error("Failed to subscribe to swap events", "error", err)
-		return nil, fmt.Errorf("failed to get price: %w", err)
-	}
-	u.sub[symbol] = priceChan
-	slog.Info("Subscribed to Uniswap V3 pool", "symbol", symbol, "address", poolAddress.Hex())
-	go func() {
-		defer func() {
-			slog.Info("Unsubscribing from Uniswap V3 pool", "symbol", symbol)
-			sub.Unsubscribe()
-			close(priceChan)
-			delete(u.sub, symbol)
-		}()
-		// for i := 0; i < 3; i++ {
-		// 	price := (1000 + rand.Float64()*100)
-		// 	time.Sleep(time.Second * 1)
-		// 	priceChan <- &Price{
-		// 		Pool:            "Uniswap",
-		// 		Symbol:          symbol,
-		// 		Price:           price,
-		// 		Liquidity:       big.NewInt(int64(price * 1e18)), // Assuming price is in USD, convert to wei
-		// 		LiquidityStatus: "high",
-		// 	}
-		// }
-		for {
-			select {
-			case err := <-sub.Err():
-				slog.Error("Subscription error", "error", err)
+	stream := swapStream[*contracts.UniswapV3PoolSwap]{
+		name: "Uniswap " + symbol,
+		watch: func(opts *bind.WatchOpts, sink chan<- *contracts.UniswapV3PoolSwap) (event.Subscription, error) {
+			return pool.WatchSwap(opts, sink, nil, nil)
+		},
+		filter: func(opts *bind.FilterOpts) ([]*contracts.UniswapV3PoolSwap, error) {
+			it, err := pool.FilterSwap(opts, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			defer it.Close()
+			var swaps []*contracts.UniswapV3PoolSwap
+			for it.Next() {
+				swaps = append(swaps, it.Event)
+			}
+			return swaps, it.Error()
+		},
+		log: func(swap *contracts.UniswapV3PoolSwap) types.Log { return swap.Raw },
+		rollback: func(block uint64) {
+			price, err := u.PriceAt(ctx, symbol, block)
+			if err != nil {
+				slog.Error("Failed to read price after reorg", "pool", "Uniswap", "symbol", symbol, "block", block, "error", err)
 				return
-			case swapEvent := <-swapChan:
-
-				price := CalculatePrice(swapEvent.SqrtPriceX96, config, symbol)
-				priceChan <- &Price{
-					Pool:      "Uniswap",
-					Symbol:    symbol,
-					Price:     price,
-					Liquidity: swapEvent.Liquidity,
-				}
 			}
-		}
+			price.RolledBack = true
+			publish(price)
+		},
+		polling: activePolling(),
+	}
+	go func() {
+		streamSwaps(ctx, u.cl, stream, func(swapEvent *contracts.UniswapV3PoolSwap) {
+			receivedAt := time.Now()
+			publish(&Price{
+				Pool:           "Uniswap",
+				Symbol:         symbol,
+				Price:          CalculatePrice(swapEvent.SqrtPriceX96, config, symbol),
+				Liquidity:      swapEvent.Liquidity,
+				BlockNumber:    swapEvent.Raw.BlockNumber,
+				LogIndex:       swapEvent.Raw.Index,
+				TxHash:         swapEvent.Raw.TxHash,
+				BlockTimestamp: u.clock.timestamp(ctx, swapEvent.Raw.BlockNumber),
+				ReceivedAt:     receivedAt,
+			})
+		})
 	}()
-	return priceChan, err
+	return nil
+}
+
+func (u *UniswapV3) PriceAt(ctx context.Context, symbol string, block uint64) (*Price, error) {
+	config, err := GetActiveMarkets(symbol, Uniswap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool config: %w", err)
+	}
+	pool, err := contracts.NewUniswapV3Pool(common.HexToAddress(config.Address), u.cl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pool contract: %w", err)
+	}
+
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)}
+	slot0, err := pool.Slot0(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool price at block %d: %w", block, err)
+	}
+	liquidity, err := pool.Liquidity(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool liquidity at block %d: %w", block, err)
+	}
+	return &Price{
+		Pool:           "Uniswap",
+		Symbol:         symbol,
+		Price:          CalculatePrice(slot0.SqrtPriceX96, config, symbol),
+		Liquidity:      liquidity,
+		BlockNumber:    block,
+		BlockTimestamp: u.clock.timestamp(ctx, block),
+		ReceivedAt:     time.Now(),
+	}, nil
 }
 
 // Helper function to perform swaps with common logic
-func (u *UniswapV3) performSwap(amount float64, symbol string, zeroForOne bool) (string, error) {
+func (u *UniswapV3) performSwap(ctx context.Context, from common.Address, amount float64, symbol string, zeroForOne bool, slippage float64) (*SwapResult, error) {
 	// Step 1: Get pool configuration using the new system
 	config, err := GetActiveMarkets(symbol, Uniswap)
 	if err != nil {
-		return "", fmt.Errorf("failed to get pool config: %w", err)
+		return nil, fmt.Errorf("failed to get pool config: %w", err)
 	}
 
-	myAddress := common.HexToAddress(keychain.Accounts[0])
+	// Step 2: Quote the swap and derive the slippage protections from it
+	quote, err := u.simulateSwap(ctx, from, amount, symbol, zeroForOne)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote swap: %w", err)
+	}
+	if quote.Reverted {
+		return nil, fmt.Errorf("swap quote reverted: %s", quote.RevertReason)
+	}
 
-	// Get nonce for transaction
-	nonce, err := u.cl.PendingNonceAt(context.Background(), myAddress)
+	pool, err := contracts.NewUniswapV3Pool(common.HexToAddress(config.Address), u.cl)
 	if err != nil {
-		return "", fmt.Errorf("failed to get nonce: %w", err)
+		return nil, fmt.Errorf("failed to create pool contract: %w", err)
+	}
+	slot0, err := pool.Slot0(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool price: %w", err)
 	}
 
-	// Step 5: Calculate amount with proper decimals
-	var decimals int
-	var tokenIn, tokenOut common.Address
-	if zeroForOne {
-		// Selling token0 for token1
-		decimals = config.Token0Decimals
-		tokenIn = common.HexToAddress(config.Token0Contract)
-		tokenOut = common.HexToAddress(config.Token1Contract)
-	} else {
-		// Buying token0 with token1
-		decimals = config.Token1Decimals
-		tokenIn = common.HexToAddress(config.Token1Contract)
-		tokenOut = common.HexToAddress(config.Token0Contract)
+	result := &SwapResult{
+		AmountIn:          quote.AmountIn,
+		ExpectedAmountOut: quote.AmountOut,
+		AmountOutMinimum:  minimumAmountOut(quote.AmountOut, slippage),
+		SqrtPriceLimitX96: sqrtPriceLimit(slot0.SqrtPriceX96, slippage, zeroForOne),
 	}
+	result.AmountOutMinimumReadable = FromTokenUnits(result.AmountOutMinimum, outputDecimals(config, zeroForOne))
 
-	decimalMultiplier := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
-	amountFloat := new(big.Float).SetFloat64(amount)
-	amountWithDecimals := new(big.Float).Mul(amountFloat, decimalMultiplier)
+	params := exactInputSingleParams(config, u.defaultFeeTier, amount, zeroForOne, from, result.AmountOutMinimum, result.SqrtPriceLimitX96)
 
-	amountInDecimals := new(big.Int)
-	amountWithDecimals.Int(amountInDecimals) // Convert to big.Int
+	// Step 3: Let the router pull the input token, by permit in the same
+	// transaction when the token allows it, by approval otherwise
+	permit, covered, err := u.routerAuthorization(ctx, from, params.TokenIn, params.AmountIn)
+	if err != nil {
+		return nil, err
+	}
+	if !covered {
+		if u.approver == nil {
+			return nil, fmt.Errorf("router may not spend %s and the token has no permit", params.TokenIn.Hex())
+		}
+		if err := u.approver.EnsureApprovals(ctx, from, symbol); err != nil {
+			return nil, fmt.Errorf("failed to approve router: %w", err)
+		}
+	}
 
+	// Get nonce for transaction, after any approval sent from the same account
+	nonce, err := u.cl.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
 	auth := &bind.TransactOpts{
-		From:      myAddress,
-		Nonce:     big.NewInt(int64(nonce)),
-		Value:     big.NewInt(0), // No ETH sent with swap
-		GasFeeCap: constants.GasFeeCap,
-		GasTipCap: constants.GasTipCap,
+		Context: ctx,
+		From:    from,
+		Nonce:   new(big.Int).SetUint64(nonce),
+		Value:   big.NewInt(0), // No ETH sent with swap
 		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
-			return u.kc.Sign(tx)
+			return u.kc.Sign(ctx, address, tx)
 		},
 	}
+	if err := u.cl.SetFees(ctx, auth); err != nil {
+		return nil, err
+	}
 
 	slog.Info("Swap transaction Info",
 		"symbol", symbol,
 		"amount", amount,
-		"amount_in_decimals", amountInDecimals.String(),
-		"zero_for_one", zeroForOne)
+		"amount_in_decimals", params.AmountIn.String(),
+		"expected_amount_out", result.ExpectedAmountOut.String(),
+		"amount_out_minimum", result.AmountOutMinimum.String(),
+		"sqrt_price_limit_x96", result.SqrtPriceLimitX96.String(),
+		"slippage", slippage,
+		"zero_for_one", zeroForOne,
+		"permit", permit != nil)
 
 	tm := time.Now()
 	swapRouter, _ := contracts.NewSwapRouter(common.HexToAddress(UniswapRouter), u.cl)
-	params := contracts.IV3SwapRouterExactInputSingleParams{
-		TokenIn:           tokenIn,
-		TokenOut:          tokenOut,
-		Recipient:         myAddress,
-		AmountIn:          amountInDecimals, // Amount to swap (exact input)
-		Fee:               big.NewInt(3000),
-		SqrtPriceLimitX96: big.NewInt(0),
-		AmountOutMinimum:  big.NewInt(0), // No minimum output amount
+	var tx *types.Transaction
+	if permit != nil {
+		routerAbi, abiErr := contracts.SwapRouterMetaData.GetAbi()
+		if abiErr != nil {
+			return nil, fmt.Errorf("failed to load router abi: %w", abiErr)
+		}
+		swapCall, packErr := routerAbi.Pack("exactInputSingle", params)
+		if packErr != nil {
+			return nil, fmt.Errorf("failed to pack swap calldata: %w", packErr)
+		}
+		tx, err = swapRouter.Multicall1(auth, [][]byte{permit, swapCall})
+	} else {
+		tx, err = swapRouter.ExactInputSingle(auth, params)
 	}
-	tx, err := swapRouter.ExactInputSingle(auth, params)
 
 	elasped := time.Since(tm)
 	if err != nil {
 		slog.Error("Failed to execute swap", "error", err)
-		return "", fmt.Errorf("failed to execute swap: %w", err)
+		return nil, fmt.Errorf("failed to execute swap: %w", err)
 	}
+	result.Hash = tx.Hash().Hex()
 
 	slog.Info("Swap transaction submitted",
-		"hash", tx.Hash().Hex(),
+		"hash", result.Hash,
 		"symbol", symbol,
 		"amount", amount,
 		"from_token", strings.Split(symbol, "/")[0],
 		"to_token", strings.Split(symbol, "/")[1],
 		"zero_for_one", zeroForOne,
+		"amount_out_minimum", result.AmountOutMinimum.String(),
+		"sqrt_price_limit_x96", result.SqrtPriceLimitX96.String(),
 		"executed at", elasped.String(),
 	)
-	return tx.Hash().Hex(), nil
+	return result, nil
 }
 
-func (u *UniswapV3) Buy(amount float64, symbol string) (string, error) {
+// simulateSwap packs the same exactInputSingle call performSwap would send,
+// behind the same permit when the router needs one, and executes it with
+// eth_call against the pending block.
+func (u *UniswapV3) simulateSwap(ctx context.Context, from common.Address, amount float64, symbol string, zeroForOne bool) (*SwapSimulation, error) {
+	config, err := GetActiveMarkets(symbol, Uniswap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool config: %w", err)
+	}
+
+	// Quote without protections: the output is what the swap would yield now.
+	params := exactInputSingleParams(config, u.defaultFeeTier, amount, zeroForOne, from, big.NewInt(0), big.NewInt(0))
+
+	routerAbi, err := contracts.SwapRouterMetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load router abi: %w", err)
+	}
+	permit, _, err := u.routerAuthorization(ctx, from, params.TokenIn, params.AmountIn)
+	if err != nil {
+		return nil, err
+	}
+	calldata, err := swapCalldata(routerAbi, params, permit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack swap calldata: %w", err)
+	}
+
+	router := common.HexToAddress(UniswapRouter)
+	result := &SwapSimulation{
+		Pool:       "Uniswap",
+		Symbol:     symbol,
+		ZeroForOne: zeroForOne,
+		AmountIn:   params.AmountIn,
+		AmountOut:  big.NewInt(0),
+	}
+
+	output, err := u.cl.CallContract(ctx, ethereum.CallMsg{
+		From: from,
+		To:   &router,
+		Data: calldata,
+	}, pendingBlock)
+	if err != nil {
+		reason, reverted := revertReason(err)
+		if !reverted {
+			return nil, fmt.Errorf("failed to simulate swap: %w", err)
+		}
+		result.Reverted = true
+		result.RevertReason = reason
+		return result, nil
+	}
+
+	if result.AmountOut, err = swapOutput(routerAbi, output, permit != nil); err != nil {
+		return nil, fmt.Errorf("failed to decode simulated swap output: %w", err)
+	}
+
+	result.AmountOutReadable = FromTokenUnits(result.AmountOut, outputDecimals(config, zeroForOne))
+	return result, nil
+}
+
+func (u *UniswapV3) Buy(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*SwapResult, error) {
 	// Buy means: swap token1 (e.g., USDC) for token0 (e.g., WBNB)
 	// zeroForOne = false (token1 → token0)
-	return u.performSwap(amount, symbol, false)
+	return u.performSwap(ctx, from, amount, symbol, false, slippage)
 }
 
-func (u *UniswapV3) Sell(amount float64, symbol string) (string, error) {
+func (u *UniswapV3) Sell(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*SwapResult, error) {
 	// Sell means: swap token0 (e.g., WBNB) for token1 (e.g., USDC)
 	// zeroForOne = true (token0 → token1)
-	return u.performSwap(amount, symbol, true)
+	return u.performSwap(ctx, from, amount, symbol, true, slippage)
+}
+
+func (u *UniswapV3) SimulateBuy(ctx context.Context, from common.Address, amount float64, symbol string) (*SwapSimulation, error) {
+	return u.simulateSwap(ctx, from, amount, symbol, false)
+}
+
+func (u *UniswapV3) SimulateSell(ctx context.Context, from common.Address, amount float64, symbol string) (*SwapSimulation, error) {
+	return u.simulateSwap(ctx, from, amount, symbol, true)
 }
 
 // NOTE: The old createTransaction function has been removed and replaced with
@@ -205,6 +354,7 @@ func (u *UniswapV3) Sell(amount float64, symbol string) (string, error) {
 // 4. Provides better error handling and logging
 // 5. Supports both buy and sell operations with proper swap directions
 
-func (u *UniswapV3) GetPoolFee() float64 {
-	return u.platformFee
+func (u *UniswapV3) GetPoolFee(symbol string) float64 {
+	config, _ := GetActiveMarkets(symbol, Uniswap)
+	return feeRatio(config, u.defaultFeeTier)
 }
@@ -0,0 +1,158 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/contracts"
+)
+
+// ValidatePoolConfigs checks every pool configured on the active network
+// against the chain before trading begins. Missing token contracts, symbols
+// and decimals are filled in from the pool and its ERC20 tokens; anything that
+// contradicts the chain (wrong chain, wrong token order, wrong decimals) is
+// returned as an error.
+func ValidatePoolConfigs(ctx context.Context, cl *blockchain.Client) error {
+	chainID, err := cl.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read chain id: %w", err)
+	}
+	if chainID.Int64() != int64(blockchain.ActiveChain.ChainID) {
+		return fmt.Errorf("connected to chain %d but %s %s expects %d",
+			chainID, blockchain.ActiveChain.ChainName, blockchain.ActiveChain.Network, blockchain.ActiveChain.ChainID)
+	}
+
+	networkMap, err := activeNetworkPools()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for app, pools := range networkMap {
+		for symbol, config := range pools {
+			if err := validatePoolConfig(ctx, cl, app, symbol, config); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", app, symbol, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validatePoolConfig(ctx context.Context, cl *blockchain.Client, app DexApp, symbol string, config *PoolConfig) error {
+	poolAddress := common.HexToAddress(config.Address)
+	code, err := cl.CodeAt(ctx, poolAddress, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read code at %s: %w", config.Address, err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract at %s on chain %d, pool belongs to another chain",
+			config.Address, blockchain.ActiveChain.ChainID)
+	}
+
+	token0, token1, err := readPoolTokens(ctx, cl, app, poolAddress)
+	if err != nil {
+		return fmt.Errorf("failed to read pool tokens: %w", err)
+	}
+
+	if err := resolveTokenContract(&config.Token0Contract, token0, token1, "token0"); err != nil {
+		return err
+	}
+	if err := resolveTokenContract(&config.Token1Contract, token1, token0, "token1"); err != nil {
+		return err
+	}
+
+	var errs []error
+	if err := resolveTokenMetadata(ctx, cl, token0, &config.Token0, &config.Token0Decimals); err != nil {
+		errs = append(errs, fmt.Errorf("token0: %w", err))
+	}
+	if err := resolveTokenMetadata(ctx, cl, token1, &config.Token1, &config.Token1Decimals); err != nil {
+		errs = append(errs, fmt.Errorf("token1: %w", err))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	slog.Info("Validated pool config",
+		"dex", app,
+		"symbol", symbol,
+		"address", config.Address,
+		"token0", config.Token0Contract,
+		"token1", config.Token1Contract)
+	return nil
+}
+
+// resolveTokenContract fills an empty contract address with the on-chain
+// token, or verifies the configured one matches it.
+func resolveTokenContract(configured *string, onChain, other common.Address, position string) error {
+	if *configured == "" {
+		*configured = onChain.Hex()
+		return nil
+	}
+
+	configuredAddress := common.HexToAddress(*configured)
+	if configuredAddress == onChain {
+		return nil
+	}
+	if configuredAddress == other {
+		return fmt.Errorf("wrong token order: %s is configured as %s but the pool has it as the other token", *configured, position)
+	}
+	return fmt.Errorf("%s is %s on-chain but configured as %s", position, onChain.Hex(), *configured)
+}
+
+// resolveTokenMetadata fills an empty symbol and zero decimals from the ERC20
+// contract, and verifies them otherwise. A symbol mismatch is only logged
+// since configs use aliases such as ETH for WETH.
+func resolveTokenMetadata(ctx context.Context, cl *blockchain.Client, token common.Address, symbol *string, decimals *int) error {
+	onChainSymbol, onChainDecimals, err := tokenMetadata(ctx, cl, token)
+	if err != nil {
+		return err
+	}
+
+	if *decimals == 0 {
+		*decimals = onChainDecimals
+	} else if *decimals != onChainDecimals {
+		return fmt.Errorf("wrong decimals for %s: configured %d, on-chain %d", token.Hex(), *decimals, onChainDecimals)
+	}
+
+	if *symbol == "" {
+		*symbol = onChainSymbol
+	} else if !strings.EqualFold(*symbol, onChainSymbol) {
+		slog.Warn("Configured token symbol differs from on-chain symbol",
+			"token", token.Hex(),
+			"configured", *symbol,
+			"onChain", onChainSymbol)
+	}
+	return nil
+}
+
+func readPoolTokens(ctx context.Context, cl *blockchain.Client, app DexApp, poolAddress common.Address) (common.Address, common.Address, error) {
+	var token0, token1 common.Address
+	switch app {
+	case Pancakeswap:
+		pool, err := contracts.NewPancakeswapV3Pool(poolAddress, cl)
+		if err != nil {
+			return token0, token1, err
+		}
+		if token0, err = pool.Token0(&bind.CallOpts{Context: ctx}); err != nil {
+			return token0, token1, err
+		}
+		token1, err = pool.Token1(&bind.CallOpts{Context: ctx})
+		return token0, token1, err
+	default:
+		pool, err := contracts.NewUniswapV3Pool(poolAddress, cl)
+		if err != nil {
+			return token0, token1, err
+		}
+		if token0, err = pool.Token0(&bind.CallOpts{Context: ctx}); err != nil {
+			return token0, token1, err
+		}
+		token1, err = pool.Token1(&bind.CallOpts{Context: ctx})
+		return token0, token1, err
+	}
+}
@@ -0,0 +1,177 @@
+package dex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/contracts"
+)
+
+// fakeChain answers eth_call with canned outputs per contract and method, so
+// contract reads can be tested without a node. Calls it has no answer for
+// revert.
+type fakeChain struct {
+	t       *testing.T
+	outputs map[common.Address]map[string]hexutil.Bytes
+}
+
+func newFakeChain(t *testing.T) *fakeChain {
+	return &fakeChain{t: t, outputs: make(map[common.Address]map[string]hexutil.Bytes)}
+}
+
+// respond makes method of the contract at address return values whatever it
+// is called with.
+func (f *fakeChain) respond(address common.Address, meta *bind.MetaData, method string, values ...any) {
+	f.t.Helper()
+	f.respondTo(address, meta, method, nil, values...)
+}
+
+// respondTo makes method of the contract at address return values when it is
+// called with args. Answers for exact arguments take precedence.
+func (f *fakeChain) respondTo(address common.Address, meta *bind.MetaData, method string, args []any, values ...any) {
+	f.t.Helper()
+	contractAbi, err := meta.GetAbi()
+	if err != nil {
+		f.t.Fatalf("Expected the contract abi, got %v", err)
+	}
+	input := contractAbi.Methods[method].ID
+	if args != nil {
+		if input, err = contractAbi.Pack(method, args...); err != nil {
+			f.t.Fatalf("Expected to pack %s arguments, got %v", method, err)
+		}
+	}
+	output, err := contractAbi.Methods[method].Outputs.Pack(values...)
+	if err != nil {
+		f.t.Fatalf("Expected to pack %s, got %v", method, err)
+	}
+	if f.outputs[address] == nil {
+		f.outputs[address] = make(map[string]hexutil.Bytes)
+	}
+	f.outputs[address][string(input)] = output
+}
+
+// client serves the fake chain over JSON-RPC until the test ends.
+func (f *fakeChain) client() *blockchain.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response := map[string]any{"jsonrpc": "2.0", "id": request.ID}
+		switch request.Method {
+		case "eth_getCode":
+			var address common.Address
+			json.Unmarshal(request.Params[0], &address)
+			if f.outputs[address] != nil {
+				response["result"] = "0x01"
+			} else {
+				response["result"] = "0x"
+			}
+		case "eth_call":
+			var call struct {
+				To    common.Address `json:"to"`
+				Input hexutil.Bytes  `json:"input"`
+			}
+			json.Unmarshal(request.Params[0], &call)
+			output, ok := f.outputs[call.To][string(call.Input)]
+			if !ok && len(call.Input) >= 4 {
+				output, ok = f.outputs[call.To][string(call.Input[:4])]
+			}
+			if ok {
+				response["result"] = output
+			} else {
+				response["error"] = map[string]any{"code": 3, "message": "execution reverted"}
+			}
+		default:
+			response["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	f.t.Cleanup(server.Close)
+
+	rpcClient, err := ethclient.Dial(server.URL)
+	if err != nil {
+		f.t.Fatalf("Expected to dial the fake chain, got %v", err)
+	}
+	return &blockchain.Client{Client: rpcClient}
+}
+
+var (
+	testPool   = common.HexToAddress("0x0000000000000000000000000000000000000a11")
+	testToken0 = common.HexToAddress("0x0000000000000000000000000000000000000001")
+	testToken1 = common.HexToAddress("0x0000000000000000000000000000000000000002")
+)
+
+// fakePoolChain serves a Uniswap pool of a 18 decimals WETH and a 6 decimals
+// USDC.
+func fakePoolChain(t *testing.T) *fakeChain {
+	chain := newFakeChain(t)
+	chain.respond(testPool, contracts.UniswapV3PoolMetaData, "token0", testToken0)
+	chain.respond(testPool, contracts.UniswapV3PoolMetaData, "token1", testToken1)
+	chain.respond(testToken0, contracts.ERC20MetaData, "symbol", "WETH")
+	chain.respond(testToken0, contracts.ERC20MetaData, "decimals", uint8(18))
+	chain.respond(testToken1, contracts.ERC20MetaData, "symbol", "USDC")
+	chain.respond(testToken1, contracts.ERC20MetaData, "decimals", uint8(6))
+	return chain
+}
+
+func TestValidatePoolConfig_FillsMissingTokenData(t *testing.T) {
+	// Arrange
+	cl := fakePoolChain(t).client()
+	config := &PoolConfig{Address: testPool.Hex()}
+
+	// Act
+	err := validatePoolConfig(context.Background(), cl, Uniswap, "WETH/USDC", config)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected the pool to validate, got %v", err)
+	}
+	if config.Token0Contract != testToken0.Hex() || config.Token1Contract != testToken1.Hex() {
+		t.Errorf("Expected tokens %s/%s, got %s/%s", testToken0.Hex(), testToken1.Hex(), config.Token0Contract, config.Token1Contract)
+	}
+	if config.Token0 != "WETH" || config.Token0Decimals != 18 || config.Token1 != "USDC" || config.Token1Decimals != 6 {
+		t.Errorf("Expected WETH 18 and USDC 6, got %s %d and %s %d", config.Token0, config.Token0Decimals, config.Token1, config.Token1Decimals)
+	}
+}
+
+func TestValidatePoolConfig_RejectsWrongDecimals(t *testing.T) {
+	// Arrange
+	cl := fakePoolChain(t).client()
+	config := &PoolConfig{
+		Address:        testPool.Hex(),
+		Token0:         "WETH",
+		Token1:         "USDC",
+		Token0Decimals: 18,
+		Token1Decimals: 18,
+	}
+
+	// Act
+	err := validatePoolConfig(context.Background(), cl, Uniswap, "WETH/USDC", config)
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Expected an error for the wrong decimals")
+	}
+	expected := "wrong decimals for " + testToken1.Hex() + ": configured 18, on-chain 6"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error containing %q, got %q", expected, err)
+	}
+	if !strings.HasPrefix(err.Error(), "token1: ") {
+		t.Errorf("Expected the error to name token1, got %q", err)
+	}
+}
@@ -0,0 +1,259 @@
+package keychain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// HDWalletConfig describes the accounts derived from one BIP-39 mnemonic.
+type HDWalletConfig struct {
+	// MnemonicFile holds the space separated BIP-39 words.
+	MnemonicFile string
+	// PassphraseFile holds the optional BIP-39 passphrase.
+	PassphraseFile string
+	// Paths are BIP-44 derivation paths such as m/44'/60'/0'/0/1. When empty,
+	// Count accounts are derived along m/44'/60'/0'/0/i.
+	Paths []string
+	Count int
+}
+
+// HDWalletKeychain signs for several accounts derived from one mnemonic, so
+// each trading account keeps its own nonce.
+type HDWalletKeychain struct {
+	mu       sync.RWMutex
+	accounts []common.Address
+	keys     map[common.Address]*ecdsa.PrivateKey
+}
+
+// NewHDWalletKeychainFromConfig reads the mnemonic and derives the configured accounts.
+func NewHDWalletKeychainFromConfig(config HDWalletConfig) (*HDWalletKeychain, error) {
+	if config.MnemonicFile == "" {
+		return nil, errors.New("hd wallet keychain needs HD_MNEMONIC_FILE")
+	}
+	mnemonic, err := os.ReadFile(config.MnemonicFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mnemonic file: %w", err)
+	}
+	var passphrase []byte
+	if config.PassphraseFile != "" {
+		if passphrase, err = os.ReadFile(config.PassphraseFile); err != nil {
+			return nil, fmt.Errorf("failed to read mnemonic passphrase file: %w", err)
+		}
+	}
+
+	defer clear(mnemonic)
+	defer clear(passphrase)
+
+	paths, err := derivationPaths(config.Paths, config.Count)
+	if err != nil {
+		return nil, err
+	}
+	return NewHDWalletKeychain(string(mnemonic), strings.TrimRight(string(passphrase), "\r\n"), paths)
+}
+
+// NewHDWalletKeychain derives one account per path from mnemonic. The first
+// path is the primary account.
+func NewHDWalletKeychain(mnemonic, passphrase string, paths []accounts.DerivationPath) (*HDWalletKeychain, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no derivation paths given")
+	}
+	seed, err := mnemonicSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &HDWalletKeychain{keys: make(map[common.Address]*ecdsa.PrivateKey, len(paths))}
+	for _, path := range paths {
+		key, err := deriveKey(seed, path)
+		if err != nil {
+			k.Lock()
+			return nil, fmt.Errorf("failed to derive %s: %w", path, err)
+		}
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		if _, exists := k.keys[address]; exists {
+			continue
+		}
+		k.keys[address] = key
+		k.accounts = append(k.accounts, address)
+		slog.Info("Derived HD wallet account", "path", path.String(), "address", address.Hex())
+	}
+	clear(seed)
+	return k, nil
+}
+
+func (k *HDWalletKeychain) Accounts() []common.Address {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]common.Address(nil), k.accounts...)
+}
+
+func (k *HDWalletKeychain) Sign(ctx context.Context, from common.Address, trx *types.Transaction) (*types.Transaction, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[from]
+	if !ok {
+		return nil, fmt.Errorf("no derived account %s in hd wallet", from.Hex())
+	}
+
+	signer := types.LatestSignerForChainID(big.NewInt(int64(blockchain.ActiveChain.ChainID)))
+	signedTx, err := types.SignTx(trx, signer, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return signedTx, nil
+}
+
+func (k *HDWalletKeychain) SignTypedData(ctx context.Context, from common.Address, data apitypes.TypedData) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[from]
+	if !ok {
+		return nil, fmt.Errorf("no derived account %s in hd wallet", from.Hex())
+	}
+	return signTypedDataWithKey(key, data)
+}
+
+// Lock wipes every derived key from memory. Sign fails afterwards.
+func (k *HDWalletKeychain) Lock() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range k.keys {
+		wipeInt(key.D)
+	}
+	k.keys = nil
+	k.accounts = nil
+}
+
+// derivationPaths parses the configured paths, or enumerates count accounts
+// below the default Ethereum base path.
+func derivationPaths(configured []string, count int) ([]accounts.DerivationPath, error) {
+	var paths []accounts.DerivationPath
+	for _, raw := range configured {
+		path, err := accounts.ParseDerivationPath(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path %q: %w", raw, err)
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) > 0 {
+		return paths, nil
+	}
+
+	if count <= 0 {
+		count = 1
+	}
+	next := accounts.DefaultIterator(accounts.DefaultBaseDerivationPath)
+	for i := 0; i < count; i++ {
+		// the iterator reuses its slice between calls
+		paths = append(paths, slices.Clone(next()))
+	}
+	return paths, nil
+}
+
+// mnemonicSeed turns a BIP-39 mnemonic into its 64 byte seed. The words must
+// come from the English wordlist and carry a valid checksum, so a mistyped
+// mnemonic is refused rather than deriving an unrelated wallet. Words are only
+// normalized for whitespace and case.
+func mnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, fmt.Errorf("mnemonic has %d words, expected 12, 15, 18, 21 or 24", len(words))
+	}
+	// The words themselves are never logged or returned.
+	for i, word := range words {
+		if _, ok := bip39.GetWordIndex(word); !ok {
+			return nil, fmt.Errorf("mnemonic word %d is not in the BIP-39 wordlist", i+1)
+		}
+	}
+	normalized := strings.Join(words, " ")
+	entropy, err := bip39.EntropyFromMnemonic(normalized)
+	clear(entropy)
+	if err != nil {
+		return nil, errors.New("mnemonic checksum does not match, check the words for typos")
+	}
+	return bip39.NewSeed(normalized, passphrase), nil
+}
+
+// deriveKey walks the BIP-32 private derivation of path from seed. The keys
+// and chain codes of the intermediate levels are wiped once the next level is
+// derived.
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	var key, chainCode [32]byte
+	defer clear(key[:])
+	defer clear(chainCode[:])
+	hmacSplit(&key, &chainCode, []byte("Bitcoin seed"), seed)
+
+	curveOrder := crypto.S256().Params().N
+	parentKey := new(big.Int)
+	defer wipeInt(parentKey)
+	for _, index := range path {
+		var data []byte
+		if index >= 0x80000000 {
+			data = append([]byte{0}, key[:]...)
+		} else {
+			parent, err := crypto.ToECDSA(key[:])
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&parent.PublicKey)
+			wipeInt(parent.D)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		var tweakBytes [32]byte
+		hmacSplit(&tweakBytes, &chainCode, chainCode[:], data)
+		clear(data)
+		tweak := new(big.Int).SetBytes(tweakBytes[:])
+		clear(tweakBytes[:])
+		if tweak.Cmp(curveOrder) >= 0 {
+			wipeInt(tweak)
+			return nil, fmt.Errorf("index %d derives an invalid key", index)
+		}
+		child := tweak.Add(tweak, parentKey.SetBytes(key[:]))
+		child.Mod(child, curveOrder)
+		if child.Sign() == 0 {
+			return nil, fmt.Errorf("index %d derives an invalid key", index)
+		}
+		child.FillBytes(key[:])
+		wipeInt(child)
+	}
+	return crypto.ToECDSA(key[:])
+}
+
+// hmacSplit writes the two halves of HMAC-SHA512(hmacKey, data) to left and
+// right, wiping the full digest.
+func hmacSplit(left, right *[32]byte, hmacKey, data []byte) {
+	mac := hmac.New(sha512.New, hmacKey)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	copy(left[:], sum[:32])
+	copy(right[:], sum[32:])
+	clear(sum)
+}
+
+// wipeInt zeroes the words backing n.
+func wipeInt(n *big.Int) {
+	clear(n.Bits())
+	n.SetInt64(0)
+}
@@ -0,0 +1,129 @@
+package keychain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestHDWalletKeychain_DerivesKnownAccounts(t *testing.T) {
+	// Arrange
+	paths, err := derivationPaths(nil, 2)
+	if err != nil {
+		t.Fatalf("Failed to build derivation paths: %v", err)
+	}
+
+	// Act
+	kc, err := NewHDWalletKeychain(testMnemonic, "", paths)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected derivation to succeed, got %v", err)
+	}
+	expected := []common.Address{
+		common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94"),
+		common.HexToAddress("0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0"),
+	}
+	got := kc.Accounts()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d accounts, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected account %d to be %s, got %s", i, expected[i].Hex(), got[i].Hex())
+		}
+	}
+}
+
+func TestHDWalletKeychain_SignsWithChosenAccount(t *testing.T) {
+	// Arrange
+	blockchain.ActiveChain = &blockchain.Network{ChainID: 97}
+	path, _ := accounts.ParseDerivationPath("m/44'/60'/0'/0/7")
+	kc, err := NewHDWalletKeychain(testMnemonic, "", []accounts.DerivationPath{accounts.DefaultBaseDerivationPath, path})
+	if err != nil {
+		t.Fatalf("Failed to derive accounts: %v", err)
+	}
+	second := kc.Accounts()[1]
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(97), Nonce: 1, Gas: 21000})
+
+	// Act
+	signed, err := kc.Sign(context.Background(), second, tx)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected signing to succeed, got %v", err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(97)), signed)
+	if err != nil || sender != second {
+		t.Errorf("Expected sender %s, got %s (%v)", second.Hex(), sender.Hex(), err)
+	}
+	if _, err := kc.Sign(context.Background(), common.HexToAddress("0x01"), tx); err == nil {
+		t.Errorf("Expected signing for an underived account to fail")
+	}
+}
+
+func TestHDWalletKeychain_RejectsBadMnemonic(t *testing.T) {
+	// Act
+	_, err := NewHDWalletKeychain("abandon abandon about", "", []accounts.DerivationPath{accounts.DefaultBaseDerivationPath})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error for a three word mnemonic")
+	}
+}
+
+func TestHDWalletKeychain_RejectsMnemonicTypos(t *testing.T) {
+	tests := []struct {
+		name     string
+		mnemonic string
+		expected string
+	}{
+		{
+			name:     "wrong checksum",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+			expected: "mnemonic checksum does not match, check the words for typos",
+		},
+		{
+			name:     "word outside the wordlist",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abuot",
+			expected: "mnemonic word 12 is not in the BIP-39 wordlist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			_, err := NewHDWalletKeychain(tt.mnemonic, "", []accounts.DerivationPath{accounts.DefaultBaseDerivationPath})
+
+			// Assert
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("Expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestTradingAccount_ChoosesDerivedAccount(t *testing.T) {
+	// Arrange
+	paths, _ := derivationPaths(nil, 2)
+	kc, err := NewHDWalletKeychain(testMnemonic, "", paths)
+	if err != nil {
+		t.Fatalf("Failed to derive accounts: %v", err)
+	}
+	second := kc.Accounts()[1]
+
+	// Act
+	account, err := TradingAccount(kc, second.Hex())
+
+	// Assert
+	if err != nil || account != second {
+		t.Errorf("Expected the second derived account %s, got %s (%v)", second.Hex(), account.Hex(), err)
+	}
+}
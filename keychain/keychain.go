@@ -8,40 +8,180 @@ import (
 	"log/slog"
 	"math/big"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 	"github.com/sagarkarki99/arbitrator/blockchain"
-	"github.com/sagarkarki99/arbitrator/constants"
 	"github.com/sagarkarki99/arbitrator/contracts"
 )
 
 type Keychain interface {
-	Sign(trx *types.Transaction) (*types.Transaction, error)
+	// Accounts returns the addresses this keychain can sign for.
+	Accounts() []common.Address
+	// Sign signs trx on behalf of from, which must be one of Accounts.
+	Sign(ctx context.Context, from common.Address, trx *types.Transaction) (*types.Transaction, error)
+	// SignTypedData signs the EIP-712 hash of data on behalf of from and
+	// returns the 65 byte [R || S || V] signature with V as 27 or 28.
+	SignTypedData(ctx context.Context, from common.Address, data apitypes.TypedData) ([]byte, error)
+}
+
+// signTypedDataWithKey signs the EIP-712 hash of data with key.
+func signTypedDataWithKey(key *ecdsa.PrivateKey, data apitypes.TypedData) ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash typed data: %w", err)
+	}
+	signature, err := crypto.Sign(hash, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign typed data: %w", err)
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return signature, nil
+}
+
+// PrimaryAccount returns the keychain's first account, which trades unless
+// another one is chosen.
+func PrimaryAccount(kc Keychain) (common.Address, error) {
+	accounts := kc.Accounts()
+	if len(accounts) == 0 {
+		return common.Address{}, errors.New("keychain holds no accounts")
+	}
+	return accounts[0], nil
+}
+
+// TradingAccount returns the configured account, which the keychain must be
+// able to sign for, or the primary account when none is configured.
+func TradingAccount(kc Keychain, configured string) (common.Address, error) {
+	primary, err := PrimaryAccount(kc)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if configured == "" {
+		return primary, nil
+	}
+	if !common.IsHexAddress(configured) {
+		return common.Address{}, fmt.Errorf("configured account %q is not an address", configured)
+	}
+	account := common.HexToAddress(configured)
+	if !slices.Contains(kc.Accounts(), account) {
+		return common.Address{}, fmt.Errorf("configured account %s is not held by the keychain", configured)
+	}
+	return account, nil
 }
 
 func NewKeychainImpl() Keychain {
 	return &KeychainImpl{}
 }
 
+// KeychainConfig selects and configures the Keychain implementation.
+type KeychainConfig struct {
+	// Type is "env" (raw hex key in the pk env var), "keystore", "remote" or "hdwallet".
+	Type         string
+	KeystoreFile string
+	// PasswordFile holds the keystore passphrase; when empty it is prompted for.
+	PasswordFile string
+	Remote       RemoteSignerConfig
+	HDWallet     HDWalletConfig
+}
+
+// KeychainConfigFromEnv reads KEYCHAIN, KEYSTORE_FILE, KEYSTORE_PASSWORD_FILE
+// and the REMOTE_SIGNER_* and HD_* settings.
+func KeychainConfigFromEnv() (KeychainConfig, error) {
+	config := KeychainConfig{
+		Type:         os.Getenv("KEYCHAIN"),
+		KeystoreFile: os.Getenv("KEYSTORE_FILE"),
+		PasswordFile: os.Getenv("KEYSTORE_PASSWORD_FILE"),
+		Remote: RemoteSignerConfig{
+			URL:      os.Getenv("REMOTE_SIGNER_URL"),
+			API:      os.Getenv("REMOTE_SIGNER_API"),
+			CAFile:   os.Getenv("REMOTE_SIGNER_CA_FILE"),
+			CertFile: os.Getenv("REMOTE_SIGNER_CERT_FILE"),
+			KeyFile:  os.Getenv("REMOTE_SIGNER_KEY_FILE"),
+			Account:  os.Getenv("REMOTE_SIGNER_ACCOUNT"),
+		},
+		HDWallet: HDWalletConfig{
+			MnemonicFile:   os.Getenv("HD_MNEMONIC_FILE"),
+			PassphraseFile: os.Getenv("HD_PASSPHRASE_FILE"),
+		},
+	}
+	if timeout := os.Getenv("REMOTE_SIGNER_TIMEOUT"); timeout != "" {
+		parsed, err := time.ParseDuration(timeout)
+		if err != nil || parsed <= 0 {
+			return config, fmt.Errorf("REMOTE_SIGNER_TIMEOUT %q is not a positive duration", timeout)
+		}
+		config.Remote.Timeout = parsed
+	}
+	if paths := os.Getenv("HD_DERIVATION_PATHS"); paths != "" {
+		config.HDWallet.Paths = strings.Split(paths, ",")
+	}
+	if count := os.Getenv("HD_ACCOUNT_COUNT"); count != "" {
+		parsed, err := strconv.Atoi(count)
+		if err != nil || parsed <= 0 {
+			return config, fmt.Errorf("HD_ACCOUNT_COUNT %q is not a positive number", count)
+		}
+		config.HDWallet.Count = parsed
+	}
+	return config, nil
+}
+
+// NewKeychain builds the Keychain selected by config, unlocking it if needed.
+func NewKeychain(config KeychainConfig) (Keychain, error) {
+	switch config.Type {
+	case "", "env":
+		return NewKeychainImpl(), nil
+	case "keystore":
+		if config.KeystoreFile == "" {
+			return nil, errors.New("keystore keychain needs KEYSTORE_FILE")
+		}
+		passphrase, err := ReadPassphrase(config.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeystoreKeychain(config.KeystoreFile, passphrase)
+	case "remote":
+		return NewRemoteKeychain(config.Remote)
+	case "hdwallet":
+		return NewHDWalletKeychainFromConfig(config.HDWallet)
+	default:
+		return nil, fmt.Errorf("unknown keychain type %q", config.Type)
+	}
+}
+
 type KeychainImpl struct {
 }
 
-func (k *KeychainImpl) Sign(trx *types.Transaction) (*types.Transaction, error) {
+func (k *KeychainImpl) privateKey() (*ecdsa.PrivateKey, error) {
 	pk := os.Getenv("pk")
 	privateKey, err := crypto.HexToECDSA(pk)
+	if err != nil {
+		return nil, errors.New("failed to load private key from pk")
+	}
+	return privateKey, nil
+}
+
+func (k *KeychainImpl) Accounts() []common.Address {
+	privateKey, err := k.privateKey()
+	if err != nil {
+		return nil
+	}
+	return []common.Address{crypto.PubkeyToAddress(privateKey.PublicKey)}
+}
+
+func (k *KeychainImpl) Sign(ctx context.Context, from common.Address, trx *types.Transaction) (*types.Transaction, error) {
+	privateKey, err := k.privateKey()
 	if err != nil {
 		return nil, errors.New("failed to sign transaction")
 	}
-	pubkey := privateKey.Public()
-	pubkeyECDSA, ok := pubkey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, errors.New("failed to cast public key to ECDSA")
+	if address := crypto.PubkeyToAddress(privateKey.PublicKey); address != from {
+		return nil, fmt.Errorf("cannot sign for %s with key of %s", from.Hex(), address.Hex())
 	}
-	slog.Info("From address:", "address", crypto.PubkeyToAddress(*pubkeyECDSA).Hex())
 
 	signer := types.LatestSignerForChainID(big.NewInt(int64(blockchain.ActiveChain.ChainID)))
 	signedTx, err := types.SignTx(trx, signer, privateKey)
@@ -52,8 +192,19 @@ func (k *KeychainImpl) Sign(trx *types.Transaction) (*types.Transaction, error)
 	return signedTx, nil
 }
 
-func GetBalance(address string, tokenContract string, cl *ethclient.Client) (*big.Int, error) {
-	myAddress := common.HexToAddress(Accounts[0])
+func (k *KeychainImpl) SignTypedData(ctx context.Context, from common.Address, data apitypes.TypedData) ([]byte, error) {
+	privateKey, err := k.privateKey()
+	if err != nil {
+		return nil, errors.New("failed to sign typed data")
+	}
+	if address := crypto.PubkeyToAddress(privateKey.PublicKey); address != from {
+		return nil, fmt.Errorf("cannot sign for %s with key of %s", from.Hex(), address.Hex())
+	}
+	return signTypedDataWithKey(privateKey, data)
+}
+
+func GetBalance(ctx context.Context, address string, tokenContract string, cl *blockchain.Client) (*big.Int, error) {
+	myAddress := common.HexToAddress(address)
 	contract := common.HexToAddress(tokenContract)
 
 	erc20, err := contracts.NewERC20(contract, cl)
@@ -62,7 +213,7 @@ func GetBalance(address string, tokenContract string, cl *ethclient.Client) (*bi
 		return nil, fmt.Errorf("failed to create ERC20 contract: %w", err)
 	}
 
-	balance, err := erc20.BalanceOf(&bind.CallOpts{}, myAddress)
+	balance, err := erc20.BalanceOf(&bind.CallOpts{Context: ctx}, myAddress)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get balance: %w", err)
 	}
@@ -77,62 +228,63 @@ func ConvertReadable(balance *big.Int, decimal int) *big.Float {
 	return humanBalance
 }
 
-func GetNativeBalance(address string, cl *ethclient.Client) (*big.Int, error) {
+func GetNativeBalance(ctx context.Context, address string, cl *blockchain.Client) (*big.Int, error) {
 
 	myAddress := common.HexToAddress(address)
-	ethBalance, err := cl.BalanceAt(context.Background(), myAddress, nil)
+	ethBalance, err := cl.BalanceAt(ctx, myAddress, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get ETH balance: %w", err)
 	}
 
-	ethBalanceFloat := new(big.Float).SetInt(ethBalance)
-	ethDivisor := new(big.Float).SetInt(big.NewInt(1e18)) // 18 decimals for ETH
-	ethHuman := new(big.Float).Quo(ethBalanceFloat, ethDivisor)
-	fmt.Printf("ETH Balance: %s ETH\n", ethHuman.String())
+	slog.Info("Native balance", "address", myAddress.Hex(), "balance", ConvertReadable(ethBalance, 18).String(), "symbol", cl.NativeSymbol())
 	return ethBalance, nil
 }
 
-func HasApproval(spender string, contractAddress string, cl *ethclient.Client) bool {
-	sp := common.HexToAddress(spender)
-	contractAddr := common.HexToAddress(contractAddress)
-	erc20, _ := contracts.NewERC20(contractAddr, cl)
-	allowance, err := erc20.Allowance(&bind.CallOpts{}, sp, contractAddr)
+// WrapNative sends amount wei of from's native coin to the wrapped native token's
+// deposit. It returns once the transaction is sent, not mined.
+func WrapNative(ctx context.Context, from common.Address, amount *big.Int, wrapperContract string, cl *blockchain.Client, kc Keychain) (*types.Transaction, error) {
+	con, err := contracts.NewERC20(common.HexToAddress(wrapperContract), cl)
 	if err != nil {
-		slog.Error("Failed to get allowance", "error", err)
-		return false
+		return nil, fmt.Errorf("failed to create wrapped native contract: %w", err)
 	}
-
-	fmt.Printf("Pool allowance: %s \n", allowance.String())
-
-	if allowance.Cmp(big.NewInt(0)) == 0 {
-		slog.Error("Pool has no allowance to spend your USDC! Run approval first.")
-		return false
+	opts := &bind.TransactOpts{
+		From:  from,
+		Value: amount, // native amount to wrap
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return kc.Sign(ctx, address, tx)
+		},
+	}
+	if err := cl.SetFees(ctx, opts); err != nil {
+		return nil, err
+	}
+	trx, err := con.Deposit(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap native: %w", err)
 	}
-	return true
+	slog.Info("Deposit transaction sent", "hash", trx.Hash().Hex(), "amount", amount)
+	return trx, nil
 }
 
-func WrapNative(amount float64, wrapperContract string, cl *ethclient.Client, kc Keychain) {
-	ethAmount := amount
-	weiAmount := new(big.Float).SetFloat64(ethAmount)
-	weiAmount.Mul(weiAmount, big.NewFloat(1e18))
-	eth, _ := weiAmount.Int(new(big.Int))
-
-	WrappedAddress := common.HexToAddress(wrapperContract)
-	con, _ := contracts.NewERC20(WrappedAddress, cl)
-	trx, err := con.Deposit(&bind.TransactOpts{
-		From:      common.HexToAddress(Accounts[0]),
-		Value:     eth, // ETH amount to wrap
-		GasFeeCap: constants.GasFeeCap,
-		GasTipCap: constants.GasTipCap,
+// UnwrapNative withdraws amount wei of from's wrapped native token back to
+// native coin. It returns once the transaction is sent, not mined.
+func UnwrapNative(ctx context.Context, from common.Address, amount *big.Int, wrapperContract string, cl *blockchain.Client, kc Keychain) (*types.Transaction, error) {
+	con, err := contracts.NewERC20(common.HexToAddress(wrapperContract), cl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wrapped native contract: %w", err)
+	}
+	opts := &bind.TransactOpts{
+		From: from,
 		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
-			return kc.Sign(tx)
+			return kc.Sign(ctx, address, tx)
 		},
-	})
-
-	slog.Info("Deposit transaction sent", "hash", trx.Hash().Hex())
-
+	}
+	if err := cl.SetFees(ctx, opts); err != nil {
+		return nil, err
+	}
+	trx, err := con.Withdraw(opts, amount)
 	if err != nil {
-		slog.Error("Failed to wrap ETH to WETH", "error", err)
-		return
+		return nil, fmt.Errorf("failed to unwrap native: %w", err)
 	}
+	slog.Info("Withdraw transaction sent", "hash", trx.Hash().Hex(), "amount", amount)
+	return trx, nil
 }
@@ -0,0 +1,119 @@
+package keychain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"golang.org/x/term"
+)
+
+// KeystoreKeychain signs with a key decrypted once from a go-ethereum V3
+// keystore file. The decrypted key lives only in this struct and is wiped
+// by Lock.
+type KeystoreKeychain struct {
+	mu  sync.RWMutex
+	key *keystore.Key
+}
+
+// NewKeystoreKeychain decrypts the V3 keystore file with passphrase.
+func NewKeystoreKeychain(keyfile, passphrase string) (*KeystoreKeychain, error) {
+	keyJSON, err := os.ReadFile(keyfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore file: %w", err)
+	}
+
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock keystore: %w", err)
+	}
+
+	slog.Info("Keystore unlocked", "address", key.Address.Hex())
+	return &KeystoreKeychain{key: key}, nil
+}
+
+func (k *KeystoreKeychain) Accounts() []common.Address {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.key == nil {
+		return nil
+	}
+	return []common.Address{k.key.Address}
+}
+
+func (k *KeystoreKeychain) Sign(ctx context.Context, from common.Address, trx *types.Transaction) (*types.Transaction, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.key == nil {
+		return nil, errors.New("keystore is locked")
+	}
+	if from != k.key.Address {
+		return nil, fmt.Errorf("cannot sign for %s with key of %s", from.Hex(), k.key.Address.Hex())
+	}
+
+	signer := types.LatestSignerForChainID(big.NewInt(int64(blockchain.ActiveChain.ChainID)))
+	signedTx, err := types.SignTx(trx, signer, k.key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return signedTx, nil
+}
+
+func (k *KeystoreKeychain) SignTypedData(ctx context.Context, from common.Address, data apitypes.TypedData) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.key == nil {
+		return nil, errors.New("keystore is locked")
+	}
+	if from != k.key.Address {
+		return nil, fmt.Errorf("cannot sign for %s with key of %s", from.Hex(), k.key.Address.Hex())
+	}
+	return signTypedDataWithKey(k.key.PrivateKey, data)
+}
+
+// Lock wipes the decrypted key from memory. Sign fails afterwards.
+func (k *KeystoreKeychain) Lock() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.key == nil {
+		return
+	}
+	clear(k.key.PrivateKey.D.Bits())
+	k.key.PrivateKey.D.SetInt64(0)
+	k.key = nil
+	slog.Info("Keystore locked")
+}
+
+// ReadPassphrase reads the keystore passphrase from passwordFile, or prompts
+// for it on the terminal without echo when no file is given.
+func ReadPassphrase(passwordFile string) (string, error) {
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no password file given and stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, "Keystore passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(passphrase), nil
+}
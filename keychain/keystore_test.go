@@ -0,0 +1,128 @@
+package keychain
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+func writeTestKeystore(t *testing.T, passphrase string) (string, common.Address) {
+	t.Helper()
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	key := &keystore.Key{
+		Id:         uuid.New(),
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		PrivateKey: privateKey,
+	}
+	keyJSON, err := keystore.EncryptKey(key, passphrase, keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatalf("Failed to encrypt key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, keyJSON, 0o600); err != nil {
+		t.Fatalf("Failed to write keystore: %v", err)
+	}
+	return path, key.Address
+}
+
+func TestKeystoreKeychain_SignsWithUnlockedKey(t *testing.T) {
+	// Arrange
+	blockchain.ActiveChain = &blockchain.Network{ChainID: 97}
+	path, address := writeTestKeystore(t, "secret")
+	kc, err := NewKeystoreKeychain(path, "secret")
+	if err != nil {
+		t.Fatalf("Failed to unlock keystore: %v", err)
+	}
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(97), Nonce: 1, Gas: 21000})
+
+	// Act
+	signed, err := kc.Sign(context.Background(), address, tx)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected signing to succeed, got %v", err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(97)), signed)
+	if err != nil || sender != address {
+		t.Errorf("Expected sender %s, got %s (%v)", address.Hex(), sender.Hex(), err)
+	}
+}
+
+func TestKeystoreKeychain_WrongPassphrase(t *testing.T) {
+	// Arrange
+	path, _ := writeTestKeystore(t, "secret")
+
+	// Act
+	_, err := NewKeystoreKeychain(path, "wrong")
+
+	// Assert
+	if err == nil {
+		t.Error("Expected wrong passphrase to be rejected")
+	}
+}
+
+func TestKeystoreKeychain_LockWipesKey(t *testing.T) {
+	// Arrange
+	blockchain.ActiveChain = &blockchain.Network{ChainID: 97}
+	path, address := writeTestKeystore(t, "secret")
+	kc, err := NewKeystoreKeychain(path, "secret")
+	if err != nil {
+		t.Fatalf("Failed to unlock keystore: %v", err)
+	}
+	privateKey := kc.key.PrivateKey
+
+	// Act
+	kc.Lock()
+	_, signErr := kc.Sign(context.Background(), address, types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(97)}))
+
+	// Assert
+	if signErr == nil {
+		t.Error("Expected locked keystore to refuse signing")
+	}
+	if privateKey.D.Sign() != 0 {
+		t.Error("Expected private key to be zeroed")
+	}
+}
+
+func TestTradingAccount(t *testing.T) {
+	// Arrange
+	path, address := writeTestKeystore(t, "secret")
+	kc, err := NewKeystoreKeychain(path, "secret")
+	if err != nil {
+		t.Fatalf("Failed to unlock keystore: %v", err)
+	}
+
+	// Act
+	matched, matchErr := TradingAccount(kc, address.Hex())
+	primary, primaryErr := TradingAccount(kc, "")
+	_, mismatchErr := TradingAccount(kc, "0x42E45cC2929312cfE071eDF35F423434ED92E316")
+	kc.Lock()
+	_, lockedErr := TradingAccount(kc, "")
+
+	// Assert
+	if matchErr != nil || matched != address {
+		t.Errorf("Expected matching account %s, got %s (%v)", address.Hex(), matched.Hex(), matchErr)
+	}
+	if primaryErr != nil || primary != address {
+		t.Errorf("Expected the primary account %s without configuration, got %s (%v)", address.Hex(), primary.Hex(), primaryErr)
+	}
+	if mismatchErr == nil {
+		t.Error("Expected mismatched account to be rejected")
+	}
+	if lockedErr == nil {
+		t.Error("Expected keychain without accounts to be rejected")
+	}
+}
@@ -0,0 +1,60 @@
+package keychain
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// PermitTypes is the EIP-2612 Permit struct.
+var PermitTypes = []apitypes.Type{
+	{Name: "owner", Type: "address"},
+	{Name: "spender", Type: "address"},
+	{Name: "value", Type: "uint256"},
+	{Name: "nonce", Type: "uint256"},
+	{Name: "deadline", Type: "uint256"},
+}
+
+// DomainTypes lists the EIP712Domain fields set in domain, in the order the
+// standard defines them.
+func DomainTypes(domain apitypes.TypedDataDomain) []apitypes.Type {
+	var types []apitypes.Type
+	if domain.Name != "" {
+		types = append(types, apitypes.Type{Name: "name", Type: "string"})
+	}
+	if domain.Version != "" {
+		types = append(types, apitypes.Type{Name: "version", Type: "string"})
+	}
+	if domain.ChainId != nil {
+		types = append(types, apitypes.Type{Name: "chainId", Type: "uint256"})
+	}
+	if domain.VerifyingContract != "" {
+		types = append(types, apitypes.Type{Name: "verifyingContract", Type: "address"})
+	}
+	if domain.Salt != "" {
+		types = append(types, apitypes.Type{Name: "salt", Type: "bytes32"})
+	}
+	return types
+}
+
+// PermitTypedData builds the EIP-2612 message letting spender pull value of
+// the token described by domain from owner until deadline.
+func PermitTypedData(domain apitypes.TypedDataDomain, owner, spender common.Address, value, nonce, deadline *big.Int) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": DomainTypes(domain),
+			"Permit":       PermitTypes,
+		},
+		PrimaryType: "Permit",
+		Domain:      domain,
+		Message: apitypes.TypedDataMessage{
+			"owner":    owner.Hex(),
+			"spender":  spender.Hex(),
+			"value":    (*math.HexOrDecimal256)(value),
+			"nonce":    (*math.HexOrDecimal256)(nonce),
+			"deadline": (*math.HexOrDecimal256)(deadline),
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package keychain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+func TestSignTypedData_RecoversToOwner(t *testing.T) {
+	// Arrange
+	kc, err := NewHDWalletKeychain(testMnemonic, "", []accounts.DerivationPath{accounts.DefaultBaseDerivationPath})
+	if err != nil {
+		t.Fatalf("Failed to derive account: %v", err)
+	}
+	owner := kc.Accounts()[0]
+	domain := apitypes.TypedDataDomain{
+		Name:              "Token",
+		Version:           "1",
+		ChainId:           math.NewHexOrDecimal256(97),
+		VerifyingContract: "0x55d398326f99059fF775485246999027B3197955",
+	}
+	data := PermitTypedData(domain, owner, common.HexToAddress("0x01"), big.NewInt(1), big.NewInt(0), big.NewInt(1))
+
+	// Act
+	signature, err := kc.SignTypedData(context.Background(), owner, data)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected signing to succeed, got %v", err)
+	}
+	if len(signature) != crypto.SignatureLength || (signature[64] != 27 && signature[64] != 28) {
+		t.Fatalf("Expected a 65 byte signature with v of 27 or 28, got %x", signature)
+	}
+	hash, _, _ := apitypes.TypedDataAndHash(data)
+	recoverable := append([]byte{}, signature...)
+	recoverable[64] -= 27
+	publicKey, err := crypto.SigToPub(hash, recoverable)
+	if err != nil || crypto.PubkeyToAddress(*publicKey) != owner {
+		t.Errorf("Expected signature to recover to %s, got %v", owner.Hex(), err)
+	}
+}
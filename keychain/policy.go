@@ -0,0 +1,267 @@
+package keychain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sagarkarki99/arbitrator/contracts"
+)
+
+// SigningPolicy lists the contracts the bot may call and how much native
+// value a single transaction may carry.
+type SigningPolicy struct {
+	Routers []common.Address
+	Pools   []common.Address
+	Tokens  []common.Address
+	// Executors are trusted contracts without an ABI in abis/; any call to
+	// them is allowed.
+	Executors []common.Address
+	// MaxValue caps the native value of one transaction. Nil allows none.
+	MaxValue *big.Int
+}
+
+// SigningPolicyFromEnv reads POLICY_EXECUTORS (comma separated addresses) and
+// POLICY_MAX_NATIVE_VALUE (wei). Routers, pools and tokens come from the
+// active pool registry and are filled in by the caller.
+func SigningPolicyFromEnv() (SigningPolicy, error) {
+	var policy SigningPolicy
+	if executors := os.Getenv("POLICY_EXECUTORS"); executors != "" {
+		for _, executor := range strings.Split(executors, ",") {
+			executor = strings.TrimSpace(executor)
+			if !common.IsHexAddress(executor) {
+				return policy, fmt.Errorf("POLICY_EXECUTORS: %q is not an address", executor)
+			}
+			policy.Executors = append(policy.Executors, common.HexToAddress(executor))
+		}
+	}
+	if maxValue := os.Getenv("POLICY_MAX_NATIVE_VALUE"); maxValue != "" {
+		value, ok := new(big.Int).SetString(maxValue, 10)
+		if !ok || value.Sign() < 0 {
+			return policy, fmt.Errorf("POLICY_MAX_NATIVE_VALUE %q is not an amount of wei", maxValue)
+		}
+		policy.MaxValue = value
+	}
+	return policy, nil
+}
+
+// PolicyError is returned by PolicyKeychain.Sign for a transaction the
+// signing policy does not allow.
+type PolicyError struct {
+	To     common.Address
+	Method string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	method := e.Method
+	if method == "" {
+		method = "transaction"
+	}
+	return fmt.Sprintf("signing policy rejected %s to %s: %s", method, e.To.Hex(), e.Reason)
+}
+
+// policyTarget is an allowlisted contract with the ABI its calldata is
+// decoded against and the methods that may be called on it.
+type policyTarget struct {
+	kind    string
+	abi     *abi.ABI
+	methods []string
+}
+
+var (
+	routerMethods = []string{
+		"exactInputSingle", "exactInput", "exactOutputSingle", "exactOutput", "multicall",
+		"selfPermit", "selfPermitIfNecessary", "selfPermitAllowed", "selfPermitAllowedIfNecessary",
+		"refundETH", "unwrapWETH9", "wrapETH", "sweepToken",
+	}
+	poolMethods  = []string{"swap"}
+	tokenMethods = []string{"approve", "deposit", "withdraw"}
+)
+
+// PolicyKeychain checks every transaction against a SigningPolicy before
+// passing it to the wrapped Keychain.
+type PolicyKeychain struct {
+	inner   Keychain
+	policy  SigningPolicy
+	targets map[common.Address]policyTarget
+}
+
+func NewPolicyKeychain(inner Keychain, policy SigningPolicy) (*PolicyKeychain, error) {
+	routerABI, err := contracts.SwapRouterMetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load router abi: %w", err)
+	}
+	// Uniswap and Pancakeswap pools share the swap signature.
+	poolABI, err := contracts.UniswapV3PoolMetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pool abi: %w", err)
+	}
+	tokenABI, err := contracts.ERC20MetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load erc20 abi: %w", err)
+	}
+
+	targets := make(map[common.Address]policyTarget)
+	for _, token := range policy.Tokens {
+		targets[token] = policyTarget{kind: "token", abi: tokenABI, methods: tokenMethods}
+	}
+	for _, pool := range policy.Pools {
+		targets[pool] = policyTarget{kind: "pool", abi: poolABI, methods: poolMethods}
+	}
+	for _, router := range policy.Routers {
+		targets[router] = policyTarget{kind: "router", abi: routerABI, methods: routerMethods}
+	}
+	for _, executor := range policy.Executors {
+		targets[executor] = policyTarget{kind: "executor"}
+	}
+	return &PolicyKeychain{inner: inner, policy: policy, targets: targets}, nil
+}
+
+func (p *PolicyKeychain) Accounts() []common.Address {
+	return p.inner.Accounts()
+}
+
+func (p *PolicyKeychain) Sign(ctx context.Context, from common.Address, trx *types.Transaction) (*types.Transaction, error) {
+	if err := p.Check(from, trx); err != nil {
+		return nil, err
+	}
+	return p.inner.Sign(ctx, from, trx)
+}
+
+func (p *PolicyKeychain) SignTypedData(ctx context.Context, from common.Address, data apitypes.TypedData) ([]byte, error) {
+	if err := p.CheckTypedData(from, data); err != nil {
+		return nil, err
+	}
+	return p.inner.SignTypedData(ctx, from, data)
+}
+
+// CheckTypedData only lets EIP-2612 permits through, for allowlisted tokens,
+// owned by the signer and granted to a known spender.
+func (p *PolicyKeychain) CheckTypedData(from common.Address, data apitypes.TypedData) error {
+	token := common.HexToAddress(data.Domain.VerifyingContract)
+	if data.PrimaryType != "Permit" || !reflect.DeepEqual(data.Types["Permit"], PermitTypes) {
+		return &PolicyError{To: token, Method: data.PrimaryType, Reason: "only EIP-2612 permits may be signed"}
+	}
+	if target, ok := p.targets[token]; !ok || target.kind != "token" {
+		return &PolicyError{To: token, Method: "permit", Reason: "token is not allowlisted"}
+	}
+	owner, _ := data.Message["owner"].(string)
+	if !common.IsHexAddress(owner) || common.HexToAddress(owner) != from {
+		return &PolicyError{To: token, Method: "permit", Reason: fmt.Sprintf("permit owner %q is not the signer", owner)}
+	}
+	spender, _ := data.Message["spender"].(string)
+	if !common.IsHexAddress(spender) || !p.isSpender(common.HexToAddress(spender)) {
+		return &PolicyError{To: token, Method: "permit", Reason: fmt.Sprintf("permit to unknown spender %q", spender)}
+	}
+	return nil
+}
+
+// Check returns a *PolicyError when trx, sent from from, breaks the policy.
+func (p *PolicyKeychain) Check(from common.Address, trx *types.Transaction) error {
+	to := trx.To()
+	if to == nil {
+		return &PolicyError{Reason: "contract creation is not allowed"}
+	}
+
+	maxValue := p.policy.MaxValue
+	if maxValue == nil {
+		maxValue = new(big.Int)
+	}
+	// Wrapping keeps the value in the signer's account, so deposits into an
+	// allowlisted token are not capped.
+	if trx.Value().Cmp(maxValue) > 0 && !p.isDeposit(*to, trx.Data()) {
+		return &PolicyError{To: *to, Reason: fmt.Sprintf("value %s exceeds the maximum of %s wei", trx.Value(), maxValue)}
+	}
+
+	target, ok := p.targets[*to]
+	if !ok {
+		return &PolicyError{To: *to, Reason: "target is not allowlisted"}
+	}
+	if target.abi == nil {
+		return nil
+	}
+	return p.checkCall(from, *to, target, trx.Data())
+}
+
+func (p *PolicyKeychain) checkCall(from, to common.Address, target policyTarget, data []byte) error {
+	if len(data) < 4 {
+		return &PolicyError{To: to, Reason: fmt.Sprintf("plain transfers to a %s are not allowed", target.kind)}
+	}
+	method, err := target.abi.MethodById(data[:4])
+	if err != nil {
+		return &PolicyError{To: to, Reason: fmt.Sprintf("unknown %s method selector %s", target.kind, hexutil.Encode(data[:4]))}
+	}
+	if !slices.Contains(target.methods, method.RawName) {
+		return &PolicyError{To: to, Method: method.RawName, Reason: fmt.Sprintf("method is not allowed on a %s", target.kind)}
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return &PolicyError{To: to, Method: method.RawName, Reason: "malformed call data"}
+	}
+
+	switch method.RawName {
+	case "approve":
+		spender, _ := args[0].(common.Address)
+		if !p.isSpender(spender) {
+			return &PolicyError{To: to, Method: method.RawName, Reason: fmt.Sprintf("approval to unknown spender %s", spender.Hex())}
+		}
+	case "multicall":
+		// Every overload takes the batched calls as its last argument.
+		calls, _ := args[len(args)-1].([][]byte)
+		for _, call := range calls {
+			if err := p.checkCall(from, to, target, call); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, input := range method.Inputs {
+		if recipient, ok := recipientArgument(input, args[i]); ok && recipient != from {
+			return &PolicyError{To: to, Method: method.RawName, Reason: fmt.Sprintf("pays out to %s instead of the signer", recipient.Hex())}
+		}
+	}
+	return nil
+}
+
+func (p *PolicyKeychain) isDeposit(to common.Address, data []byte) bool {
+	target, ok := p.targets[to]
+	if !ok || target.kind != "token" || len(data) < 4 {
+		return false
+	}
+	method, err := target.abi.MethodById(data[:4])
+	return err == nil && method.RawName == "deposit"
+}
+
+// isSpender reports whether spender may be approved or permitted: routers
+// pull tokens for swaps, pools never do.
+func (p *PolicyKeychain) isSpender(spender common.Address) bool {
+	target, ok := p.targets[spender]
+	return ok && (target.kind == "router" || target.kind == "executor")
+}
+
+// recipientArgument finds a recipient either as a plain argument or as a
+// field of a struct argument such as exactInputSingle's params.
+func recipientArgument(input abi.Argument, value any) (common.Address, bool) {
+	if input.Name == "recipient" {
+		recipient, ok := value.(common.Address)
+		return recipient, ok
+	}
+	if input.Type.T == abi.TupleTy {
+		field := reflect.ValueOf(value).FieldByName("Recipient")
+		if field.IsValid() {
+			recipient, ok := field.Interface().(common.Address)
+			return recipient, ok
+		}
+	}
+	return common.Address{}, false
+}
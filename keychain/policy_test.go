@@ -0,0 +1,170 @@
+package keychain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sagarkarki99/arbitrator/contracts"
+)
+
+type stubKeychain struct {
+	account common.Address
+}
+
+func (s *stubKeychain) Accounts() []common.Address {
+	return []common.Address{s.account}
+}
+
+func (s *stubKeychain) Sign(ctx context.Context, from common.Address, trx *types.Transaction) (*types.Transaction, error) {
+	return trx, nil
+}
+
+func (s *stubKeychain) SignTypedData(ctx context.Context, from common.Address, data apitypes.TypedData) ([]byte, error) {
+	return []byte{}, nil
+}
+
+var (
+	policyAccount = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	policyRouter  = common.HexToAddress("0x13f4EA83D0bd40E75C8222255bc855a974568Dd4")
+	policyPool    = common.HexToAddress("0x7f51c8AaA6B0599aBd16674e2b17FEc7a9f674A1")
+	policyToken   = common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+	policyOther   = common.HexToAddress("0x00000000000000000000000000000000000000b2")
+)
+
+func newTestPolicyKeychain(t *testing.T) *PolicyKeychain {
+	t.Helper()
+	kc, err := NewPolicyKeychain(&stubKeychain{account: policyAccount}, SigningPolicy{
+		Routers:  []common.Address{policyRouter},
+		Pools:    []common.Address{policyPool},
+		Tokens:   []common.Address{policyToken},
+		MaxValue: big.NewInt(100),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create policy keychain: %v", err)
+	}
+	return kc
+}
+
+func callTx(to common.Address, value int64, data []byte) *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(56), Gas: 100000, To: &to, Value: big.NewInt(value), Data: data})
+}
+
+func exactInputSingle(t *testing.T, recipient common.Address) []byte {
+	t.Helper()
+	routerABI, _ := contracts.SwapRouterMetaData.GetAbi()
+	data, err := routerABI.Pack("exactInputSingle", contracts.IV3SwapRouterExactInputSingleParams{
+		TokenIn:           policyToken,
+		TokenOut:          policyOther,
+		Fee:               big.NewInt(2500),
+		Recipient:         recipient,
+		AmountIn:          big.NewInt(1),
+		AmountOutMinimum:  big.NewInt(1),
+		SqrtPriceLimitX96: big.NewInt(0),
+	})
+	if err != nil {
+		t.Fatalf("Failed to pack exactInputSingle: %v", err)
+	}
+	return data
+}
+
+func TestPolicyKeychain_AllowsKnownCalls(t *testing.T) {
+	// Arrange
+	kc := newTestPolicyKeychain(t)
+	erc20ABI, _ := contracts.ERC20MetaData.GetAbi()
+	approve, _ := erc20ABI.Pack("approve", policyRouter, big.NewInt(1))
+	deposit, _ := erc20ABI.Pack("deposit")
+	routerABI, _ := contracts.SwapRouterMetaData.GetAbi()
+	multicall, err := routerABI.Pack("multicall1", [][]byte{exactInputSingle(t, policyAccount)})
+	if err != nil {
+		t.Fatalf("Failed to pack multicall: %v", err)
+	}
+	txs := map[string]*types.Transaction{
+		"swap":             callTx(policyRouter, 0, exactInputSingle(t, policyAccount)),
+		"approve":          callTx(policyToken, 0, approve),
+		"multicall":        callTx(policyRouter, 0, multicall),
+		"deposit over max": callTx(policyToken, 1000, deposit),
+	}
+
+	for name, tx := range txs {
+		// Act
+		_, err := kc.Sign(context.Background(), policyAccount, tx)
+
+		// Assert
+		if err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", name, err)
+		}
+	}
+}
+
+func TestPolicyKeychain_RejectsOutsidePolicy(t *testing.T) {
+	// Arrange
+	kc := newTestPolicyKeychain(t)
+	erc20ABI, _ := contracts.ERC20MetaData.GetAbi()
+	approveUnknown, _ := erc20ABI.Pack("approve", policyOther, big.NewInt(1))
+	approvePool, _ := erc20ABI.Pack("approve", policyPool, big.NewInt(1))
+	transfer, _ := erc20ABI.Pack("transfer", policyOther, big.NewInt(1))
+	routerABI, _ := contracts.SwapRouterMetaData.GetAbi()
+	multicall, err := routerABI.Pack("multicall1", [][]byte{exactInputSingle(t, policyOther)})
+	if err != nil {
+		t.Fatalf("Failed to pack multicall: %v", err)
+	}
+	txs := map[string]*types.Transaction{
+		"unknown target":    callTx(policyOther, 0, nil),
+		"value over max":    callTx(policyRouter, 101, exactInputSingle(t, policyAccount)),
+		"unknown spender":   callTx(policyToken, 0, approveUnknown),
+		"pool spender":      callTx(policyToken, 0, approvePool),
+		"token transfer":    callTx(policyToken, 0, transfer),
+		"foreign recipient": callTx(policyRouter, 0, exactInputSingle(t, policyOther)),
+		"nested recipient":  callTx(policyRouter, 0, multicall),
+		"unknown selector":  callTx(policyPool, 0, []byte{0xde, 0xad, 0xbe, 0xef}),
+	}
+
+	for name, tx := range txs {
+		// Act
+		_, err := kc.Sign(context.Background(), policyAccount, tx)
+
+		// Assert
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) {
+			t.Errorf("Expected %s to be rejected with a PolicyError, got %v", name, err)
+		}
+	}
+}
+
+func TestPolicyKeychain_ChecksPermits(t *testing.T) {
+	// Arrange
+	kc := newTestPolicyKeychain(t)
+	domain := apitypes.TypedDataDomain{Name: "Token", Version: "1", VerifyingContract: policyToken.Hex()}
+	otherDomain := apitypes.TypedDataDomain{Name: "Other", Version: "1", VerifyingContract: policyOther.Hex()}
+	permit := func(domain apitypes.TypedDataDomain, owner, spender common.Address) apitypes.TypedData {
+		return PermitTypedData(domain, owner, spender, big.NewInt(1), big.NewInt(0), big.NewInt(1))
+	}
+	notPermit := permit(domain, policyAccount, policyRouter)
+	notPermit.PrimaryType = "Transfer"
+	rejected := map[string]apitypes.TypedData{
+		"unknown spender": permit(domain, policyAccount, policyOther),
+		"unknown token":   permit(otherDomain, policyAccount, policyRouter),
+		"foreign owner":   permit(domain, policyOther, policyRouter),
+		"not a permit":    notPermit,
+	}
+
+	// Act
+	_, err := kc.SignTypedData(context.Background(), policyAccount, permit(domain, policyAccount, policyRouter))
+
+	// Assert
+	if err != nil {
+		t.Errorf("Expected permit to the router to be signed, got %v", err)
+	}
+	for name, data := range rejected {
+		_, err := kc.SignTypedData(context.Background(), policyAccount, data)
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) {
+			t.Errorf("Expected %s to be rejected with a PolicyError, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package keychain
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+// Remote signer APIs understood by RemoteKeychain.
+const (
+	// SignerClef speaks Clef's account_list / account_signTransaction.
+	SignerClef = "clef"
+	// SignerWeb3Signer speaks the Web3Signer eth1 eth_accounts / eth_signTransaction.
+	SignerWeb3Signer = "web3signer"
+)
+
+const defaultSignerTimeout = 10 * time.Second
+
+// RemoteSignerConfig points a RemoteKeychain at an external signer.
+type RemoteSignerConfig struct {
+	URL string
+	// API is SignerClef (the default) or SignerWeb3Signer.
+	API string
+	// CAFile verifies the signer's certificate instead of the system roots.
+	CAFile string
+	// CertFile and KeyFile present a client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// Timeout bounds every request to the signer.
+	Timeout time.Duration
+	// Account skips listing accounts on the signer when set.
+	Account string
+}
+
+// RemoteKeychain keeps keys off the trading host: transactions are sent
+// unsigned to an external signer and only the signed result comes back.
+type RemoteKeychain struct {
+	client   *rpc.Client
+	api      string
+	timeout  time.Duration
+	accounts []common.Address
+}
+
+// signTxResult is the response of Clef's account_signTransaction.
+type signTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// NewRemoteKeychain connects to the signer and resolves the accounts it signs for.
+func NewRemoteKeychain(config RemoteSignerConfig) (*RemoteKeychain, error) {
+	if config.URL == "" {
+		return nil, errors.New("remote signer url is required")
+	}
+	api := config.API
+	if api == "" {
+		api = SignerClef
+	}
+	if api != SignerClef && api != SignerWeb3Signer {
+		return nil, fmt.Errorf("unknown remote signer api %q", config.API)
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultSignerTimeout
+	}
+
+	tlsConfig, err := signerTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient := &http.Client{Transport: transport, Timeout: timeout}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	client, err := rpc.DialOptions(ctx, config.URL, rpc.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to remote signer: %w", err)
+	}
+
+	k := &RemoteKeychain{client: client, api: api, timeout: timeout}
+	if config.Account != "" {
+		if !common.IsHexAddress(config.Account) {
+			client.Close()
+			return nil, fmt.Errorf("remote signer account %q is not an address", config.Account)
+		}
+		k.accounts = []common.Address{common.HexToAddress(config.Account)}
+	} else if k.accounts, err = k.listAccounts(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	slog.Info("Connected to remote signer", "api", api, "accounts", len(k.accounts))
+	return k, nil
+}
+
+func signerTLSConfig(config RemoteSignerConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signer CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signer client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (k *RemoteKeychain) listAccounts() ([]common.Address, error) {
+	method := "account_list"
+	if k.api == SignerWeb3Signer {
+		method = "eth_accounts"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
+	defer cancel()
+	var accounts []common.Address
+	if err := k.client.CallContext(ctx, &accounts, method); err != nil {
+		return nil, fmt.Errorf("failed to list remote signer accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+func (k *RemoteKeychain) Accounts() []common.Address {
+	return k.accounts
+}
+
+func (k *RemoteKeychain) Sign(ctx context.Context, from common.Address, trx *types.Transaction) (*types.Transaction, error) {
+	chainID := big.NewInt(int64(blockchain.ActiveChain.ChainID))
+	args := sendTxArgs(from, trx, chainID)
+
+	ctx, cancel := context.WithTimeout(ctx, k.timeout)
+	defer cancel()
+	var raw hexutil.Bytes
+	switch k.api {
+	case SignerWeb3Signer:
+		if err := k.client.CallContext(ctx, &raw, "eth_signTransaction", args); err != nil {
+			return nil, fmt.Errorf("remote signer refused transaction: %w", err)
+		}
+	default:
+		var result signTxResult
+		if err := k.client.CallContext(ctx, &result, "account_signTransaction", args); err != nil {
+			return nil, fmt.Errorf("remote signer refused transaction: %w", err)
+		}
+		raw = result.Raw
+	}
+
+	signedTx := new(types.Transaction)
+	if err := signedTx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("failed to decode signed transaction: %w", err)
+	}
+
+	// The signer is trusted with keys, not with the trade: it must sign
+	// exactly the transaction that was asked for, from the account asked for.
+	signer := types.LatestSignerForChainID(chainID)
+	if signer.Hash(signedTx) != signer.Hash(trx) {
+		return nil, errors.New("remote signer returned a different transaction than requested")
+	}
+	sender, err := types.Sender(signer, signedTx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover signer of remote signature: %w", err)
+	}
+	if sender != from {
+		return nil, fmt.Errorf("remote signer signed as %s instead of %s", sender.Hex(), from.Hex())
+	}
+	return signedTx, nil
+}
+
+func (k *RemoteKeychain) SignTypedData(ctx context.Context, from common.Address, data apitypes.TypedData) ([]byte, error) {
+	method := "account_signTypedData"
+	if k.api == SignerWeb3Signer {
+		method = "eth_signTypedData"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, k.timeout)
+	defer cancel()
+	var signature hexutil.Bytes
+	if err := k.client.CallContext(ctx, &signature, method, common.NewMixedcaseAddress(from), data); err != nil {
+		return nil, fmt.Errorf("remote signer refused typed data: %w", err)
+	}
+	if len(signature) != crypto.SignatureLength {
+		return nil, fmt.Errorf("remote signer returned a %d byte signature", len(signature))
+	}
+	if signature[crypto.RecoveryIDOffset] < 27 {
+		signature[crypto.RecoveryIDOffset] += 27
+	}
+
+	hash, _, err := apitypes.TypedDataAndHash(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash typed data: %w", err)
+	}
+	recoverable := slices.Clone(signature)
+	recoverable[crypto.RecoveryIDOffset] -= 27
+	publicKey, err := crypto.SigToPub(hash, recoverable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover signer of remote signature: %w", err)
+	}
+	if signer := crypto.PubkeyToAddress(*publicKey); signer != from {
+		return nil, fmt.Errorf("remote signer signed as %s instead of %s", signer.Hex(), from.Hex())
+	}
+	return signature, nil
+}
+
+// Close releases the connection to the signer.
+func (k *RemoteKeychain) Close() {
+	k.client.Close()
+}
+
+func sendTxArgs(from common.Address, trx *types.Transaction, chainID *big.Int) apitypes.SendTxArgs {
+	data := hexutil.Bytes(trx.Data())
+	args := apitypes.SendTxArgs{
+		From:    common.NewMixedcaseAddress(from),
+		Gas:     hexutil.Uint64(trx.Gas()),
+		Value:   hexutil.Big(*trx.Value()),
+		Nonce:   hexutil.Uint64(trx.Nonce()),
+		Data:    &data,
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if to := trx.To(); to != nil {
+		recipient := common.NewMixedcaseAddress(*to)
+		args.To = &recipient
+	}
+	if trx.Type() == types.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(trx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(trx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(trx.GasPrice())
+	}
+	if accessList := trx.AccessList(); len(accessList) > 0 {
+		args.AccessList = &accessList
+	}
+	return args
+}
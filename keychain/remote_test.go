@@ -0,0 +1,222 @@
+package keychain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+// standInSigner is a minimal Clef / Web3Signer replacement holding one key.
+type standInSigner struct {
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+	// tamper makes the signer bump the nonce before signing.
+	tamper bool
+}
+
+func (s *standInSigner) address() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+func (s *standInSigner) sign(args apitypes.SendTxArgs) (hexutil.Bytes, error) {
+	if args.From.Address() != s.address() {
+		return nil, errors.New("unknown account")
+	}
+	if s.tamper {
+		args.Nonce++
+	}
+	tx, err := args.ToTransaction()
+	if err != nil {
+		return nil, err
+	}
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(s.chainID), s.key)
+	if err != nil {
+		return nil, err
+	}
+	return signed.MarshalBinary()
+}
+
+type clefAPI struct{ signer *standInSigner }
+
+func (api *clefAPI) List() []common.Address {
+	return []common.Address{api.signer.address()}
+}
+
+func (api *clefAPI) SignTransaction(args apitypes.SendTxArgs, methodSelector *string) (*signTxResult, error) {
+	raw, err := api.signer.sign(args)
+	if err != nil {
+		return nil, err
+	}
+	return &signTxResult{Raw: raw}, nil
+}
+
+type web3SignerAPI struct{ signer *standInSigner }
+
+func (api *web3SignerAPI) Accounts() []common.Address {
+	return []common.Address{api.signer.address()}
+}
+
+func (api *web3SignerAPI) SignTransaction(args apitypes.SendTxArgs) (hexutil.Bytes, error) {
+	return api.signer.sign(args)
+}
+
+// startStandInSigner serves both signer APIs over TLS and returns the server
+// with the path of a CA file trusting it.
+func startStandInSigner(t *testing.T, signer *standInSigner) (*httptest.Server, string) {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &clefAPI{signer}); err != nil {
+		t.Fatalf("Failed to register clef api: %v", err)
+	}
+	if err := server.RegisterName("eth", &web3SignerAPI{signer}); err != nil {
+		t.Fatalf("Failed to register web3signer api: %v", err)
+	}
+	httpServer := httptest.NewTLSServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: httpServer.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	return httpServer, caFile
+}
+
+func newStandInSigner(t *testing.T) *standInSigner {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return &standInSigner{key: key, chainID: big.NewInt(97)}
+}
+
+func TestRemoteKeychain_SignsThroughBothAPIs(t *testing.T) {
+	blockchain.ActiveChain = &blockchain.Network{ChainID: 97}
+	to := common.HexToAddress("0x13f4EA83D0bd40E75C8222255bc855a974568Dd4")
+	tests := []struct {
+		api string
+		tx  *types.Transaction
+	}{
+		{SignerClef, types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(97), Nonce: 3, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), To: &to, Value: big.NewInt(5), Data: []byte{0x01}})},
+		{SignerWeb3Signer, types.NewTx(&types.LegacyTx{Nonce: 4, Gas: 21000, GasPrice: big.NewInt(3), To: &to, Value: big.NewInt(5)})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.api, func(t *testing.T) {
+			// Arrange
+			signer := newStandInSigner(t)
+			server, caFile := startStandInSigner(t, signer)
+			kc, err := NewRemoteKeychain(RemoteSignerConfig{URL: server.URL, API: tt.api, CAFile: caFile, Timeout: time.Second})
+			if err != nil {
+				t.Fatalf("Failed to connect to stand-in signer: %v", err)
+			}
+			defer kc.Close()
+
+			// Act
+			signed, err := kc.Sign(context.Background(), signer.address(), tt.tx)
+
+			// Assert
+			if accounts := kc.Accounts(); len(accounts) != 1 || accounts[0] != signer.address() {
+				t.Errorf("Expected accounts [%s], got %v", signer.address().Hex(), accounts)
+			}
+			if err != nil {
+				t.Fatalf("Expected signing to succeed, got %v", err)
+			}
+			sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(97)), signed)
+			if err != nil || sender != signer.address() {
+				t.Errorf("Expected sender %s, got %s (%v)", signer.address().Hex(), sender.Hex(), err)
+			}
+			if signed.Nonce() != tt.tx.Nonce() || signed.Type() != tt.tx.Type() {
+				t.Errorf("Expected nonce %d type %d, got nonce %d type %d", tt.tx.Nonce(), tt.tx.Type(), signed.Nonce(), signed.Type())
+			}
+		})
+	}
+}
+
+func TestRemoteKeychain_RejectsAlteredTransaction(t *testing.T) {
+	// Arrange
+	blockchain.ActiveChain = &blockchain.Network{ChainID: 97}
+	signer := newStandInSigner(t)
+	signer.tamper = true
+	server, caFile := startStandInSigner(t, signer)
+	kc, err := NewRemoteKeychain(RemoteSignerConfig{URL: server.URL, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("Failed to connect to stand-in signer: %v", err)
+	}
+	defer kc.Close()
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(97), Nonce: 1, Gas: 21000})
+
+	// Act
+	_, err = kc.Sign(context.Background(), signer.address(), tx)
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "different transaction") {
+		t.Errorf("Expected altered transaction to be rejected, got %v", err)
+	}
+}
+
+func TestRemoteKeychain_RejectsUntrustedCertificate(t *testing.T) {
+	// Arrange
+	server, _ := startStandInSigner(t, newStandInSigner(t))
+
+	// Act
+	_, err := NewRemoteKeychain(RemoteSignerConfig{URL: server.URL})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error for a signer with an untrusted certificate")
+	}
+}
+
+func TestRemoteKeychain_TimesOut(t *testing.T) {
+	// Arrange
+	blockchain.ActiveChain = &blockchain.Network{ChainID: 97}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	account := common.HexToAddress("0x3bFA4769FB09eefC5a80d6E87c3B9C650f7Ae48E")
+	kc, err := NewRemoteKeychain(RemoteSignerConfig{URL: server.URL, Account: account.Hex(), Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create remote keychain: %v", err)
+	}
+	defer kc.Close()
+
+	// Act
+	start := time.Now()
+	_, err = kc.Sign(context.Background(), account, types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(97), Gas: 21000}))
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected signing to give up after the timeout, took %s", elapsed)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"log/slog"
@@ -8,8 +9,11 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/joho/godotenv"
 	"github.com/sagarkarki99/arbitrator/blockchain"
 	"github.com/sagarkarki99/arbitrator/dex"
@@ -26,33 +30,203 @@ func main() {
 
 	fmt.Println("Hello arbitrator")
 
-	cl := blockchain.Connect(blockchain.GetChains()["BscMainnet"])
-	if cl == nil {
-		slog.Error("Shutting down...")
+	if err := run(); err != nil {
+		slog.Error("Shutting down", "error", err)
 		os.Exit(1)
 	}
-	defer func() {
-		if cl != nil {
-			slog.Info("Closing client connection")
-			cl.Close()
+}
+
+// run starts the bot and blocks until it is stopped by a signal. Startup
+// failures are returned rather than exiting, so the deferred keychain wipe
+// and client close still run.
+func run() error {
+	if path := os.Getenv("NETWORKS_CONFIG"); path != "" {
+		if err := blockchain.LoadNetworks(path); err != nil {
+			return fmt.Errorf("failed to load network config: %w", err)
 		}
+	}
+
+	networkName := os.Getenv("NETWORK")
+	if networkName == "" {
+		networkName = "BscMainnet"
+	}
+	network, exists := blockchain.GetChains()[networkName]
+	if !exists {
+		return fmt.Errorf("unknown network %q", networkName)
+	}
+
+	cl, err := blockchain.Connect(network)
+	if err != nil {
+		return fmt.Errorf("could not connect: %w", err)
+	}
+	defer func() {
+		slog.Info("Closing client connection")
+		cl.Close()
 	}()
 
+	// ctx is cancelled on shutdown and stops every subscription and loop.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
 	// config, _ := dex.GetActiveMarkets("USDC/WETH", dex.Uniswap)
 	// fmt.Printf("Pool config: %+v\n", config)
 
-	kc := keychain.NewKeychainImpl()
-	uniswap := dex.NewUniswapV3Pool(cl, kc)
+	if path := os.Getenv("POOL_REGISTRY"); path != "" {
+		if err := dex.LoadRegistry(path, os.Getenv("POOL_REGISTRY_MERGE") == "true"); err != nil {
+			return fmt.Errorf("failed to load pool registry: %w", err)
+		}
+	}
+	if err := dex.ValidatePoolConfigs(ctx, cl); err != nil {
+		return fmt.Errorf("invalid pool configuration: %w", err)
+	}
+	if os.Getenv("DISCOVER_POOLS") == "true" {
+		if err := dex.NewPoolDiscovery(cl).DiscoverActivePools(ctx); err != nil {
+			return fmt.Errorf("failed to discover pools: %w", err)
+		}
+	}
+	if err := dex.LoadPoolFees(ctx, cl); err != nil {
+		return fmt.Errorf("failed to load pool fees: %w", err)
+	}
+
+	keychainConfig, err := keychain.KeychainConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid keychain config: %w", err)
+	}
+	kc, err := keychain.NewKeychain(keychainConfig)
+	if err != nil {
+		return fmt.Errorf("failed to set up keychain: %w", err)
+	}
+	if locker, ok := kc.(interface{ Lock() }); ok {
+		defer locker.Lock()
+	}
+	if closer, ok := kc.(interface{ Close() }); ok {
+		defer closer.Close()
+	}
+	if os.Getenv("SIGNING_POLICY") != "off" {
+		policy, err := keychain.SigningPolicyFromEnv()
+		if err != nil {
+			return fmt.Errorf("invalid signing policy: %w", err)
+		}
+		if policy.Routers, policy.Pools, policy.Tokens, err = dex.TradingContracts(); err != nil {
+			return fmt.Errorf("failed to build signing policy: %w", err)
+		}
+		if kc, err = keychain.NewPolicyKeychain(kc, policy); err != nil {
+			return fmt.Errorf("failed to set up signing policy: %w", err)
+		}
+	}
+	owner, err := keychain.TradingAccount(kc, os.Getenv("TRADING_ACCOUNT"))
+	if err != nil {
+		return fmt.Errorf("keychain cannot sign for the trading account: %w", err)
+	}
+	slog.Info("Trading from account", "account", owner.Hex())
+
+	orderConfig := services.DefaultOrderConfig
+	orderConfigPath := os.Getenv("ORDER_CONFIG")
+	if orderConfigPath != "" {
+		loaded, err := services.LoadOrderConfig(orderConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load order config: %w", err)
+		}
+		orderConfig = loaded
+	}
+
+	zeroFirst, err := services.ZeroFirstTokensFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid approval config: %w", err)
+	}
+	approvals := services.NewApprovalManager(cl, kc, zeroFirst)
+	uniswap := dex.NewUniswapV3Pool(cl, kc, approvals)
 	pancake := dex.NewPancakeswapV2Pool(cl, kc)
+	if p, ok := uniswap.(dex.Permitter); ok {
+		approvals.SetPermitter(dex.Uniswap, p)
+	}
+	err = approvals.EnsureApprovals(ctx, owner, orderConfig.ActiveSymbol)
+	approvals.Report()
+	if err != nil {
+		return fmt.Errorf("failed to set up token approvals: %w", err)
+	}
+
+	confirmations, err := services.TradeConfirmationsFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid trade tracking config: %w", err)
+	}
+	shutdownTimeout := 3 * time.Minute
+	if raw := os.Getenv("SHUTDOWN_TIMEOUT"); raw != "" {
+		if shutdownTimeout, err = time.ParseDuration(raw); err != nil || shutdownTimeout <= 0 {
+			return fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q, expected a positive duration", raw)
+		}
+	}
 
-	arbService := services.NewArbService(uniswap, pancake, services.DefaultOrderConfig)
-	go arbService.Start()
+	inventory := services.NewInventory(cl, owner, confirmations)
+	if err := inventory.Track(ctx, orderConfig.ActiveSymbol); err != nil {
+		return fmt.Errorf("failed to load inventory: %w", err)
+	}
+	inventory.Report()
+	go inventory.Watch(ctx)
+
+	// Every transaction from owner is sent under sends, so concurrent senders
+	// never pick the same pending nonce.
+	sends := &sync.Mutex{}
+	var gate services.TradingGate
+	if wrapped := blockchain.ActiveChain.WrappedNative; wrapped != "" {
+		reserveConfig, err := services.GasReserveConfigFromEnv()
+		if err != nil {
+			return fmt.Errorf("invalid gas reserve config: %w", err)
+		}
+		reserve := services.NewGasReserveManager(cl, kc, owner, common.HexToAddress(wrapped), sends, reserveConfig)
+		if err := reserve.Check(ctx); err != nil {
+			slog.Error("Failed to rebalance gas reserve", "error", err)
+		}
+		go reserve.Run(ctx)
+		gate = reserve
+	}
+
+	arbService := services.NewArbService(uniswap, pancake, owner, sends, orderConfig, approvals, inventory, gate)
+	switch mode := os.Getenv("EVALUATION_MODE"); mode {
+	case "", "swaps":
+	case "blocks":
+		arbService.EvaluateOnHeads(cl.WatchHeads(ctx))
+	default:
+		return fmt.Errorf("invalid evaluation mode %q, expected swaps or blocks", mode)
+	}
+	arbDone := make(chan struct{})
+	go func() {
+		defer close(arbDone)
+		arbService.Start(ctx)
+	}()
+
+	if orderConfigPath != "" {
+		watcher := services.NewConfigWatcher(orderConfigPath, arbService)
+		go func() {
+			if err := watcher.Watch(ctx); err != nil {
+				slog.Error("Order config watcher stopped", "error", err)
+			}
+		}()
+	}
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	signalReceived := <-sig
 	log.Println("Goroutines: ", runtime.NumGoroutine())
 	log.Println("Shutting down...", signalReceived.String())
+
+	// Stop evaluating and let the arbitrage being sent, if any, finish. Its
+	// trades and any earlier ones are then followed until they are final.
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	select {
+	case <-arbDone:
+		slog.Info("Stopped trading")
+	case <-shutdownCtx.Done():
+		slog.Warn("Arbitrage still running at shutdown timeout")
+	}
+	if err := inventory.WaitTrades(shutdownCtx); err != nil {
+		slog.Warn("Exiting with trades in flight", "error", err)
+	} else {
+		slog.Info("All trades are final")
+	}
+	return nil
 }
 
 /*
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/contracts"
+	"github.com/sagarkarki99/arbitrator/dex"
+	"github.com/sagarkarki99/arbitrator/keychain"
+)
+
+// ApprovalChecker makes sure the dex adapters may spend owner's tokens
+// before a trade is sent.
+type ApprovalChecker interface {
+	EnsureApprovals(ctx context.Context, owner common.Address, symbol string) error
+}
+
+// ZeroFirstTokens reject changing a non-zero allowance to another non-zero
+// value, so they are approved to zero before being approved to max.
+var ZeroFirstTokens = []common.Address{
+	common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), // USDT on Ethereum mainnet
+}
+
+// ZeroFirstTokensFromEnv returns ZeroFirstTokens plus the comma separated
+// addresses in APPROVAL_ZERO_FIRST_TOKENS.
+func ZeroFirstTokensFromEnv() ([]common.Address, error) {
+	tokens := slices.Clone(ZeroFirstTokens)
+	if configured := os.Getenv("APPROVAL_ZERO_FIRST_TOKENS"); configured != "" {
+		for _, token := range strings.Split(configured, ",") {
+			token = strings.TrimSpace(token)
+			if !common.IsHexAddress(token) {
+				return nil, fmt.Errorf("APPROVAL_ZERO_FIRST_TOKENS: %q is not an address", token)
+			}
+			tokens = append(tokens, common.HexToAddress(token))
+		}
+	}
+	return tokens, nil
+}
+
+// approvalThreshold is the allowance below which a pair is approved again.
+// A max approval stays above it for any realistic trading volume.
+var approvalThreshold = new(big.Int).Lsh(big.NewInt(1), 128)
+
+const approvalTimeout = 2 * time.Minute
+
+// ApprovalState is what one spender may currently pull of one token.
+type ApprovalState struct {
+	Dex       dex.DexApp
+	Owner     common.Address
+	Token     common.Address
+	Spender   common.Address
+	Allowance *big.Int
+	// Permit is set when the adapter grants the allowance with a permit
+	// inside the swap instead of an approval.
+	Permit    bool
+	CheckedAt time.Time
+}
+
+// Sufficient reports whether the allowance needs no new approval.
+func (s ApprovalState) Sufficient() bool {
+	if s.Permit {
+		return true
+	}
+	return s.Allowance != nil && s.Allowance.Cmp(approvalThreshold) >= 0
+}
+
+// ApprovalManager checks allowance(owner, spender) for every token/spender
+// pair the adapters use and approves the ones that are running low.
+//
+// Approvals always go through the token's ERC20 approve. The swap router's
+// approveMax/approveZeroThenMax look similar but set the router's own
+// allowance towards the position manager, not the trading account's
+// allowance towards the router.
+type ApprovalManager struct {
+	cl        *blockchain.Client
+	kc        keychain.Keychain
+	zeroFirst map[common.Address]bool
+	// permitters are the adapters that can permit tokens themselves.
+	permitters map[dex.DexApp]dex.Permitter
+
+	mu     sync.Mutex
+	states map[[3]common.Address]ApprovalState
+}
+
+func NewApprovalManager(cl *blockchain.Client, kc keychain.Keychain, zeroFirst []common.Address) *ApprovalManager {
+	m := &ApprovalManager{
+		cl:         cl,
+		kc:         kc,
+		zeroFirst:  make(map[common.Address]bool, len(zeroFirst)),
+		permitters: make(map[dex.DexApp]dex.Permitter),
+		states:     make(map[[3]common.Address]ApprovalState),
+	}
+	for _, token := range zeroFirst {
+		m.zeroFirst[token] = true
+	}
+	return m
+}
+
+// SetPermitter leaves the pairs of app whose token p can permit to the
+// adapter, so no approval is sent for them.
+func (m *ApprovalManager) SetPermitter(app dex.DexApp, p dex.Permitter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.permitters[app] = p
+}
+
+// EnsureApprovals checks every pair owner needs to trade symbol and approves
+// and waits for the ones below the threshold. All failing pairs are reported together.
+func (m *ApprovalManager) EnsureApprovals(ctx context.Context, owner common.Address, symbol string) error {
+	approvals, err := dex.RequiredApprovals(symbol)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, approval := range approvals {
+		if err := m.ensure(ctx, owner, approval); err != nil {
+			errs = append(errs, fmt.Errorf("%s token %s spender %s: %w",
+				approval.Dex, approval.Token.Hex(), approval.Spender.Hex(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *ApprovalManager) ensure(ctx context.Context, owner common.Address, approval dex.TokenApproval) error {
+	token, err := contracts.NewERC20(approval.Token, m.cl)
+	if err != nil {
+		return fmt.Errorf("failed to create ERC20 contract: %w", err)
+	}
+
+	state, err := m.check(ctx, token, owner, approval)
+	if err != nil {
+		return err
+	}
+	if state.Sufficient() {
+		return nil
+	}
+
+	m.mu.Lock()
+	permitter := m.permitters[approval.Dex]
+	m.mu.Unlock()
+	if permitter != nil && permitter.SupportsPermit(ctx, approval.Token) {
+		slog.Info("Leaving approval to permit", "dex", approval.Dex, "token", approval.Token.Hex())
+		state.Permit = true
+		m.mu.Lock()
+		m.states[[3]common.Address{owner, approval.Token, approval.Spender}] = state
+		m.mu.Unlock()
+		return nil
+	}
+
+	if state.Allowance.Sign() != 0 && m.zeroFirst[approval.Token] {
+		if err := m.approve(ctx, token, owner, approval, new(big.Int)); err != nil {
+			return fmt.Errorf("failed to reset allowance to zero: %w", err)
+		}
+	}
+	if err := m.approve(ctx, token, owner, approval, abi.MaxUint256); err != nil {
+		return err
+	}
+
+	if state, err = m.check(ctx, token, owner, approval); err != nil {
+		return err
+	}
+	if !state.Sufficient() {
+		return fmt.Errorf("allowance is still %s after approval", state.Allowance)
+	}
+	return nil
+}
+
+// check reads the allowance and records it.
+func (m *ApprovalManager) check(ctx context.Context, token *contracts.ERC20, owner common.Address, approval dex.TokenApproval) (ApprovalState, error) {
+	allowance, err := token.Allowance(&bind.CallOpts{Context: ctx}, owner, approval.Spender)
+	if err != nil {
+		return ApprovalState{}, fmt.Errorf("failed to read allowance: %w", err)
+	}
+
+	state := ApprovalState{
+		Dex:       approval.Dex,
+		Owner:     owner,
+		Token:     approval.Token,
+		Spender:   approval.Spender,
+		Allowance: allowance,
+		CheckedAt: time.Now(),
+	}
+	m.mu.Lock()
+	m.states[[3]common.Address{owner, approval.Token, approval.Spender}] = state
+	m.mu.Unlock()
+	return state, nil
+}
+
+// approve sends approve(spender, amount) and waits until it is mined.
+func (m *ApprovalManager) approve(ctx context.Context, token *contracts.ERC20, owner common.Address, approval dex.TokenApproval, amount *big.Int) error {
+	ctx, cancel := context.WithTimeout(ctx, approvalTimeout)
+	defer cancel()
+
+	opts := &bind.TransactOpts{
+		From:    owner,
+		Context: ctx,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return m.kc.Sign(ctx, address, tx)
+		},
+	}
+	if err := m.cl.SetFees(ctx, opts); err != nil {
+		return err
+	}
+	tx, err := token.Approve(opts, approval.Spender, amount)
+	if err != nil {
+		return fmt.Errorf("failed to send approval: %w", err)
+	}
+	slog.Info("Approval sent",
+		"dex", approval.Dex,
+		"token", approval.Token.Hex(),
+		"spender", approval.Spender.Hex(),
+		"amount", amount,
+		"hash", tx.Hash().Hex())
+
+	receipt, err := bind.WaitMined(ctx, m.cl, tx)
+	if err != nil {
+		return fmt.Errorf("failed waiting for approval %s: %w", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("approval %s reverted", tx.Hash().Hex())
+	}
+	slog.Info("Approval confirmed", "hash", tx.Hash().Hex(), "block", receipt.BlockNumber)
+	return nil
+}
+
+// States returns the last known allowance of every pair, ordered by owner,
+// dex and token.
+func (m *ApprovalManager) States() []ApprovalState {
+	m.mu.Lock()
+	states := make([]ApprovalState, 0, len(m.states))
+	for _, state := range m.states {
+		states = append(states, state)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Owner != states[j].Owner {
+			return states[i].Owner.Cmp(states[j].Owner) < 0
+		}
+		if states[i].Dex != states[j].Dex {
+			return states[i].Dex < states[j].Dex
+		}
+		return states[i].Token.Cmp(states[j].Token) < 0
+	})
+	return states
+}
+
+// Report logs the last known allowance of every pair.
+func (m *ApprovalManager) Report() {
+	for _, state := range m.States() {
+		slog.Info("Approval state",
+			"dex", state.Dex,
+			"owner", state.Owner.Hex(),
+			"token", state.Token.Hex(),
+			"spender", state.Spender.Hex(),
+			"allowance", state.Allowance,
+			"permit", state.Permit,
+			"sufficient", state.Sufficient(),
+			"checkedAt", state.CheckedAt)
+	}
+}
@@ -1,11 +1,16 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/sagarkarki99/arbitrator/dex"
 )
 
@@ -15,6 +20,9 @@ var DefaultOrderConfig = OrderConfig{
 	Slippage:        0.001,
 	TotalGasCost:    0.0001,
 	ActiveSymbol:    "CAKE/USDT",
+
+	MaxPriceAgeSeconds: 30,
+	MaxBlockDistance:   2,
 }
 
 // var DefaultOrderConfig = OrderConfig{
@@ -26,117 +34,469 @@ var DefaultOrderConfig = OrderConfig{
 // }
 
 type OrderConfig struct {
-	AmountSize      float64
-	ProfitThreshold float64
-	Slippage        float64
-	TotalGasCost    float64
-	ActiveSymbol    string
+	AmountSize      float64 `json:"amountSize"`
+	ProfitThreshold float64 `json:"profitThreshold"`
+	Slippage        float64 `json:"slippage"`
+	TotalGasCost    float64 `json:"totalGasCost"`
+	ActiveSymbol    string  `json:"activeSymbol"`
+
+	// MaxPriceAgeSeconds and MaxBlockDistance bound how old a price may be
+	// and how many blocks apart two prices may be to be compared; zero
+	// disables the check.
+	MaxPriceAgeSeconds float64 `json:"maxPriceAgeSeconds,omitempty"`
+	MaxBlockDistance   uint64  `json:"maxBlockDistance,omitempty"`
 }
 
-type ArbService interface {
-	// Symbol is the trading pair symbol, e.g., "WETH/USDT"
-	Start()
+// MaxSlippage caps the tolerated slippage; anything above it is almost
+// certainly a typo (e.g. 1 instead of 0.01).
+const MaxSlippage = 0.05
 
-	SetConfig(newOrder OrderConfig)
+// Validate reports whether the order configuration is safe to trade with.
+func (o OrderConfig) Validate() error {
+	var errs []error
+	if o.AmountSize <= 0 {
+		errs = append(errs, fmt.Errorf("amountSize must be positive, got %v", o.AmountSize))
+	}
+	if o.ProfitThreshold <= 0 {
+		errs = append(errs, fmt.Errorf("profitThreshold must be positive, got %v", o.ProfitThreshold))
+	}
+	if o.Slippage < 0 || o.Slippage > MaxSlippage {
+		errs = append(errs, fmt.Errorf("slippage must be between 0 and %v, got %v", MaxSlippage, o.Slippage))
+	}
+	if o.TotalGasCost < 0 || o.TotalGasCost >= o.AmountSize {
+		errs = append(errs, fmt.Errorf("totalGasCost must be non-negative and below amountSize, got %v", o.TotalGasCost))
+	}
+	if o.MaxPriceAgeSeconds < 0 {
+		errs = append(errs, fmt.Errorf("maxPriceAgeSeconds must not be negative, got %v", o.MaxPriceAgeSeconds))
+	}
+	if parts := strings.Split(o.ActiveSymbol, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		errs = append(errs, fmt.Errorf("activeSymbol must look like TOKEN0/TOKEN1, got %q", o.ActiveSymbol))
+	}
+	return errors.Join(errs...)
+}
+
+type ArbService interface {
+	// Start evaluates opportunities until ctx is cancelled. It returns once
+	// the arbitrage being sent, if any, is submitted, so no trade starts
+	// after it returns.
+	Start(ctx context.Context)
+	// EvaluateOnHeads makes Start evaluate once per block received from
+	// heads instead of on every swap. It must be called before Start.
+	EvaluateOnHeads(heads <-chan uint64)
+
+	GetConfig() OrderConfig
+	SetConfig(newOrder OrderConfig) error
 }
 
 type ArbServiceImpl struct {
 	dex1 dex.Dex
 	dex2 dex.Dex
+	// account signs and receives both legs of every trade.
+	account common.Address
+	// approvals is checked before every trade; nil skips the check.
+	approvals ApprovalChecker
+	// inventory sizes trades to the account's balances; nil trades AmountSize
+	// unchecked.
+	inventory InventoryChecker
+	// gate pauses trading, e.g. while the gas reserve is short; nil never
+	// pauses.
+	gate TradingGate
+	// sends is held while the arbitrage's transactions are sent, so a
+	// rebalance from the same account cannot pick the same nonce; nil sends
+	// unguarded.
+	sends *sync.Mutex
+	// heads switches evaluation from swap events to one evaluation per new
+	// block; see EvaluateOnHeads.
+	heads <-chan uint64
 
 	ConfigMutex *sync.RWMutex
 	orderConfig OrderConfig
 }
 
-func NewArbService(dex1, dex2 dex.Dex, config OrderConfig) ArbService {
+// NewArbService trades from account. sends must be shared with everything else
+// sending from account, e.g. the gas reserve.
+func NewArbService(dex1, dex2 dex.Dex, account common.Address, sends *sync.Mutex, config OrderConfig, approvals ApprovalChecker, inventory InventoryChecker, gate TradingGate) ArbService {
 	return &ArbServiceImpl{
 		dex1:        dex1,
 		dex2:        dex2,
+		account:     account,
+		sends:       sends,
+		approvals:   approvals,
+		inventory:   inventory,
+		gate:        gate,
 		ConfigMutex: &sync.RWMutex{},
 		orderConfig: config,
 	}
 }
 
-func (a *ArbServiceImpl) SetConfig(newOrder OrderConfig) {
-	if newOrder.AmountSize <= 0 || newOrder.ProfitThreshold <= 0 {
-		slog.Error("Invalid configuration values", "amountSize", newOrder.AmountSize, "profitThreshold", newOrder.ProfitThreshold)
-		return
+func (a *ArbServiceImpl) GetConfig() OrderConfig {
+	a.ConfigMutex.RLock()
+	defer a.ConfigMutex.RUnlock()
+	return a.orderConfig
+}
+
+func (a *ArbServiceImpl) SetConfig(newOrder OrderConfig) error {
+	if err := newOrder.Validate(); err != nil {
+		slog.Error("Invalid configuration values", "error", err)
+		return err
 	}
 	a.ConfigMutex.Lock()
 	defer a.ConfigMutex.Unlock()
 	a.orderConfig = newOrder
+	return nil
+}
 
+// EvaluateOnHeads makes Start evaluate once per block received from heads,
+// on the state of every pool as of that block, instead of on every swap.
+// It must be called before Start.
+func (a *ArbServiceImpl) EvaluateOnHeads(heads <-chan uint64) {
+	a.heads = heads
 }
 
-func (a *ArbServiceImpl) Start() {
+func (a *ArbServiceImpl) Start(ctx context.Context) {
+	if a.heads != nil {
+		a.LookOpportunityOnBlocks(ctx, a.heads)
+		return
+	}
+
 	a.ConfigMutex.RLock()
 	symbol := a.orderConfig.ActiveSymbol
 	a.ConfigMutex.RUnlock()
-	price1, err := a.dex1.GetPrice(symbol)
+	price1, err := a.dex1.GetPrice(ctx, symbol)
 	if err != nil {
 		slog.Error("Failed to get price from UNISWAP", "error", err)
+		return
 	}
-	price2, err := a.dex2.GetPrice(symbol)
+	defer price1.Unsubscribe()
+	price2, err := a.dex2.GetPrice(ctx, symbol)
 	if err != nil {
 		slog.Error("Failed to get price from PANCAKE", "error", err)
+		return
 	}
+	defer price2.Unsubscribe()
 
-	// TODO: run this function in separate go routine
-	a.LookOpportunity(price1, price2)
+	a.LookOpportunity(ctx, price1.Prices(), price2.Prices())
 
 }
 
-func (a *ArbServiceImpl) LookOpportunity(asset1, asset2 <-chan *dex.Price) {
-	lastPrice1 := 0.0
-	lastPrice2 := 0.0
+func (a *ArbServiceImpl) LookOpportunity(ctx context.Context, asset1, asset2 <-chan *dex.Price) {
+	var lastPrice1, lastPrice2 *dex.Price
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case asset1Price, isOpen := <-asset1:
 			if !isOpen {
 				return
 			}
-			slog.Info(fmt.Sprintf("------- %s", asset1Price.Pool), "price", asset1Price.Price)
-			lastPrice1 = asset1Price.Price
-			if lastPrice2 != 0 && a.IsSpreadProfitable(lastPrice1, lastPrice2) && a.IsProfit(lastPrice1, lastPrice2) {
-				a.performArbitrageTransaction(lastPrice1, lastPrice2, asset1Price.Symbol)
+			slog.Info(fmt.Sprintf("------- %s", asset1Price.Pool), "price", asset1Price.Price, "block", asset1Price.BlockNumber, "rolledBack", asset1Price.RolledBack)
+			lastPrice1 = asset1Price
+			if lastPrice2 != nil && a.pricesComparable(lastPrice1, lastPrice2) && a.IsSpreadProfitable(lastPrice1.Price, lastPrice2.Price) && a.IsProfit(lastPrice1.Price, lastPrice2.Price) {
+				a.performArbitrageTransaction(ctx, lastPrice1.Price, lastPrice2.Price, asset1Price.Symbol, max(lastPrice1.BlockNumber, lastPrice2.BlockNumber))
 				// Perform arbitrage transaction
 			}
 		case asset2Price, isOpen := <-asset2:
 			if !isOpen {
 				return
 			}
-			slog.Info(fmt.Sprintf("------- %s", asset2Price.Pool), "price", asset2Price.Price)
-			lastPrice2 = asset2Price.Price
-			if lastPrice1 != 0 && a.IsSpreadProfitable(lastPrice1, lastPrice2) && a.IsProfit(lastPrice2, lastPrice1) {
-				a.performArbitrageTransaction(lastPrice1, lastPrice2, asset2Price.Symbol)
+			slog.Info(fmt.Sprintf("------- %s", asset2Price.Pool), "price", asset2Price.Price, "block", asset2Price.BlockNumber, "rolledBack", asset2Price.RolledBack)
+			lastPrice2 = asset2Price
+			if lastPrice1 != nil && a.pricesComparable(lastPrice1, lastPrice2) && a.IsSpreadProfitable(lastPrice1.Price, lastPrice2.Price) && a.IsProfit(lastPrice2.Price, lastPrice1.Price) {
+				a.performArbitrageTransaction(ctx, lastPrice1.Price, lastPrice2.Price, asset2Price.Symbol, max(lastPrice1.BlockNumber, lastPrice2.BlockNumber))
 
 			}
 		}
 	}
 }
 
-func (a *ArbServiceImpl) performArbitrageTransaction(lastPrice1, lastPrice2 float64, symbol string) {
+// pricesComparable logs and reports false when the prices fail checkFreshness.
+func (a *ArbServiceImpl) pricesComparable(price1, price2 *dex.Price) bool {
+	if err := a.checkFreshness(price1, price2, time.Now()); err != nil {
+		slog.Info("Not comparing stale prices", "symbol", price1.Symbol, "reason", err)
+		return false
+	}
+	return true
+}
+
+// checkFreshness returns why price1 and price2 must not be compared: one of
+// them is older than MaxPriceAgeSeconds at now, or they were observed more
+// than MaxBlockDistance blocks apart.
+func (a *ArbServiceImpl) checkFreshness(price1, price2 *dex.Price, now time.Time) error {
+	a.ConfigMutex.RLock()
+	maxAge := time.Duration(a.orderConfig.MaxPriceAgeSeconds * float64(time.Second))
+	maxDistance := a.orderConfig.MaxBlockDistance
+	a.ConfigMutex.RUnlock()
+
+	if maxDistance > 0 && price1.BlockNumber != 0 && price2.BlockNumber != 0 {
+		distance := max(price1.BlockNumber, price2.BlockNumber) - min(price1.BlockNumber, price2.BlockNumber)
+		if distance > maxDistance {
+			return fmt.Errorf("prices are %d blocks apart, limit is %d", distance, maxDistance)
+		}
+	}
+	if maxAge > 0 {
+		for _, price := range []*dex.Price{price1, price2} {
+			if age := price.Age(now); age > maxAge {
+				return fmt.Errorf("%s price from block %d is %s old, limit is %s", price.Pool, price.BlockNumber, age.Round(time.Millisecond), maxAge)
+			}
+		}
+	}
+	return nil
+}
+
+// LookOpportunityOnBlocks evaluates the active symbol once per block, on the
+// price of both pools as of that block, so the two sides never come from
+// different blocks. Blocks that arrive while one is evaluated are skipped in
+// favour of the latest. It returns when ctx is cancelled or heads is closed.
+func (a *ArbServiceImpl) LookOpportunityOnBlocks(ctx context.Context, heads <-chan uint64) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case block, isOpen := <-heads:
+			if !isOpen {
+				return
+			}
+			a.ConfigMutex.RLock()
+			symbol := a.orderConfig.ActiveSymbol
+			a.ConfigMutex.RUnlock()
+			a.evaluateBlock(ctx, symbol, block)
+		}
+	}
+}
+
+// evaluateBlock reads both pools at block and trades when the snapshot shows
+// a profitable spread.
+func (a *ArbServiceImpl) evaluateBlock(ctx context.Context, symbol string, block uint64) {
+	price1, err := a.dex1.PriceAt(ctx, symbol, block)
+	if err != nil {
+		slog.Error("Failed to read price, skipping block", "symbol", symbol, "block", block, "error", err)
+		return
+	}
+	price2, err := a.dex2.PriceAt(ctx, symbol, block)
+	if err != nil {
+		slog.Error("Failed to read price, skipping block", "symbol", symbol, "block", block, "error", err)
+		return
+	}
+
+	slog.Info("Block snapshot",
+		"symbol", symbol,
+		"block", block,
+		price1.Pool, price1.Price,
+		price2.Pool, price2.Price)
+	if !a.pricesComparable(price1, price2) {
+		return
+	}
+	if a.IsSpreadProfitable(price1.Price, price2.Price) && a.IsProfit(price1.Price, price2.Price) {
+		a.performArbitrageTransaction(ctx, price1.Price, price2.Price, symbol, block)
+	}
+}
+
+// ArbitrageSimulation holds the simulated legs of an arbitrage and the profit
+// they would realise, denominated in the quote token.
+type ArbitrageSimulation struct {
+	// AmountIn is the quote amount the buy leg spends.
+	AmountIn float64
+	Buy      *dex.SwapSimulation
+	Sell     *dex.SwapSimulation
+	Profit   float64
+}
+
+// performArbitrageTransaction simulates and sends the arbitrage between the
+// two prices. block is the block the prices were observed in and is logged
+// with every decision. Cancelling ctx aborts the simulation, but once the buy
+// leg is sent the sell leg is sent regardless.
+func (a *ArbServiceImpl) performArbitrageTransaction(ctx context.Context, lastPrice1, lastPrice2 float64, symbol string, block uint64) {
+	if a.gate != nil {
+		if err := a.gate.TradingAllowed(); err != nil {
+			slog.Warn("Trading is paused, skipping arbitrage", "symbol", symbol, "block", block, "reason", err)
+			return
+		}
+	}
+
+	buyDex, sellDex := a.dex2, a.dex1
 	if math.Min(lastPrice1, lastPrice2) == lastPrice1 {
 		// buy in dex1 and sell in dex2
-		// a.dex1.Buy(amountSize, symbol)
-		// a.dex2.Sell(amountSize, symbol)
+		buyDex, sellDex = a.dex1, a.dex2
 		slog.Info("--------------------")
 		slog.Info("Buy DEX1 / SELL DEX 2")
 		slog.Info("--------------------")
-
 	} else {
+		// buy in dex2 and sell in dex1
 		slog.Info("--------------------")
 		slog.Info("Buy DEX2 / SELL DEX1")
 		slog.Info("--------------------")
-		// a.dex2.Buy(amountSize, symbol)
-		// a.dex1.Sell(amountSize, symbol)
-		// buy in dex2 and sell in dex1
 	}
+
+	a.ConfigMutex.RLock()
+	amountSize := a.orderConfig.AmountSize
+	profitThreshold := a.orderConfig.ProfitThreshold
+	slippage := a.orderConfig.Slippage
+	a.ConfigMutex.RUnlock()
+
+	sim, err := a.simulateArbitrage(ctx, buyDex, sellDex, symbol, amountSize)
+	if err != nil {
+		slog.Error("Failed to simulate arbitrage, aborting", "symbol", symbol, "block", block, "error", err)
+		return
+	}
+	if a.inventory != nil {
+		if sim, err = a.sizeToInventory(ctx, buyDex, sellDex, symbol, sim); err != nil {
+			slog.Warn("Skipping arbitrage, not enough inventory", "symbol", symbol, "block", block, "error", err)
+			return
+		}
+		amountSize = sim.AmountIn
+	}
+	if sim.Buy.Reverted || sim.Sell.Reverted || sim.Profit < profitThreshold {
+		slog.Warn("Aborting arbitrage after simulation",
+			"symbol", symbol,
+			"block", block,
+			"buyPool", sim.Buy.Pool,
+			"buyAmountOut", sim.Buy.AmountOutReadable,
+			"buyRevertReason", sim.Buy.RevertReason,
+			"sellPool", sim.Sell.Pool,
+			"sellAmountOut", sim.Sell.AmountOutReadable,
+			"sellRevertReason", sim.Sell.RevertReason,
+			"simulatedProfit", sim.Profit,
+			"profitThreshold", profitThreshold)
+		return
+	}
+
+	// Approvals and both legs pick their nonces from the pending state, which
+	// must not change under them.
+	if a.sends != nil {
+		a.sends.Lock()
+		defer a.sends.Unlock()
+	}
+
+	if a.approvals != nil {
+		if err := a.approvals.EnsureApprovals(ctx, a.account, symbol); err != nil {
+			slog.Error("Token approvals are not in place, aborting", "symbol", symbol, "block", block, "error", err)
+			return
+		}
+	}
+
+	if ctx.Err() != nil {
+		slog.Info("Shutting down, not sending arbitrage", "symbol", symbol, "block", block)
+		return
+	}
+
+	var reservation *Reservation
+	if a.inventory != nil {
+		if reservation, err = a.inventory.Reserve(symbol, sim.Buy.AmountOutReadable, amountSize); err != nil {
+			slog.Warn("Skipping arbitrage, inventory is held by trades in flight", "symbol", symbol, "block", block, "error", err)
+			return
+		}
+	}
+
+	slog.Info("Simulation passed, sending arbitrage",
+		"symbol", symbol,
+		"block", block,
+		"amountSize", amountSize,
+		"simulatedProfit", sim.Profit,
+		"profitThreshold", profitThreshold)
+
+	sendCtx := context.WithoutCancel(ctx)
+	buyResult, err := buyDex.Buy(sendCtx, a.account, amountSize, symbol, slippage)
+	if err != nil {
+		slog.Error("Buy leg failed", "symbol", symbol, "block", block, "error", err)
+		if reservation != nil {
+			reservation.Release()
+		}
+		return
+	}
+	// The buy may fill below its simulation, so the sell only spends what the
+	// buy is guaranteed to deliver; any surplus stays in the inventory.
+	sellResult, err := sellDex.Sell(sendCtx, a.account, buyResult.AmountOutMinimumReadable, symbol, slippage)
+	if err != nil {
+		slog.Error("Sell leg failed", "symbol", symbol, "block", block, "error", err)
+		if reservation != nil {
+			a.inventory.TrackTrade(sendCtx, reservation, buyResult.Hash)
+		}
+		return
+	}
+	if reservation != nil {
+		a.inventory.TrackTrade(sendCtx, reservation, buyResult.Hash, sellResult.Hash)
+	}
+
+	slog.Info("Arbitrage submitted",
+		"symbol", symbol,
+		"block", block,
+		"buyHash", buyResult.Hash,
+		"buyAmountOutMinimum", buyResult.AmountOutMinimum,
+		"sellHash", sellResult.Hash,
+		"sellAmountOutMinimum", sellResult.AmountOutMinimum)
+}
+
+// simulateArbitrage simulates buying amountSize worth of the base token on
+// buyDex and selling the simulated output on sellDex. The sell leg is skipped
+// when the buy leg reverts since there is nothing to sell.
+func (a *ArbServiceImpl) simulateArbitrage(ctx context.Context, buyDex, sellDex dex.Dex, symbol string, amountSize float64) (*ArbitrageSimulation, error) {
+	a.ConfigMutex.RLock()
+	totalGasCost := a.orderConfig.TotalGasCost
+	a.ConfigMutex.RUnlock()
+
+	buySim, err := buyDex.SimulateBuy(ctx, a.account, amountSize, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("buy leg: %w", err)
+	}
+	if buySim.Reverted {
+		return &ArbitrageSimulation{AmountIn: amountSize, Buy: buySim, Sell: &dex.SwapSimulation{Symbol: symbol}, Profit: -amountSize}, nil
+	}
+
+	sellSim, err := sellDex.SimulateSell(ctx, a.account, buySim.AmountOutReadable, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("sell leg: %w", err)
+	}
+
+	profit := sellSim.AmountOutReadable - amountSize - totalGasCost
+	return &ArbitrageSimulation{AmountIn: amountSize, Buy: buySim, Sell: sellSim, Profit: profit}, nil
+}
+
+// sizeToInventory shrinks sim to what the account holds. Both legs are sent
+// back to back, so the buy leg spends quote inventory while the sell leg
+// spends base inventory that is already held. The trade is re-simulated at
+// the smaller size and skipped when nothing meaningful is left.
+func (a *ArbServiceImpl) sizeToInventory(ctx context.Context, buyDex, sellDex dex.Dex, symbol string, sim *ArbitrageSimulation) (*ArbitrageSimulation, error) {
+	base, quote, err := a.inventory.Available(symbol)
+	if err != nil {
+		return nil, err
+	}
+	a.ConfigMutex.RLock()
+	totalGasCost := a.orderConfig.TotalGasCost
+	a.ConfigMutex.RUnlock()
+
+	size := sim.AmountIn
+	if quote < size {
+		size = quote
+	}
+	if out := sim.Buy.AmountOutReadable; out > base && out > 0 {
+		// The buy output scales roughly with its input; keep a margin for
+		// the price impact of the smaller trade being slightly better.
+		size = math.Min(size, sim.AmountIn*base/out*0.99)
+	}
+	if size <= totalGasCost {
+		return nil, fmt.Errorf("available base %v and quote %v do not cover a trade", base, quote)
+	}
+	if size == sim.AmountIn {
+		return sim, nil
+	}
+
+	slog.Info("Sizing trade down to inventory", "symbol", symbol, "amountSize", sim.AmountIn, "sized", size)
+	if sim, err = a.simulateArbitrage(ctx, buyDex, sellDex, symbol, size); err != nil {
+		return nil, err
+	}
+	if !sim.Buy.Reverted && sim.Buy.AmountOutReadable > base {
+		return nil, fmt.Errorf("sell leg needs %v base, only %v available", sim.Buy.AmountOutReadable, base)
+	}
+	return sim, nil
 }
 
 func (a *ArbServiceImpl) IsSpreadProfitable(price1, price2 float64) bool {
+	a.ConfigMutex.RLock()
+	symbol := a.orderConfig.ActiveSymbol
+	slippage := a.orderConfig.Slippage
+	a.ConfigMutex.RUnlock()
 
-	feeRatio := (a.dex1.GetPoolFee() + a.dex2.GetPoolFee()) + a.orderConfig.Slippage
+	feeRatio := (a.dex1.GetPoolFee(symbol) + a.dex2.GetPoolFee(symbol)) + slippage
 	buyPrice := math.Min(price1, price2)
 	sellPrice := math.Max(price1, price2)
 	spreadRatio := ((sellPrice - buyPrice) / buyPrice)
@@ -157,6 +517,8 @@ func (a *ArbServiceImpl) IsProfit(price1, price2 float64) bool {
 	amountSize := a.orderConfig.AmountSize
 	// Assumes ProfitThreshold is also in the quote currency (e.g., USDC).
 	profitThreshold := a.orderConfig.ProfitThreshold
+	totalGasCost := a.orderConfig.TotalGasCost
+	symbol := a.orderConfig.ActiveSymbol
 	a.ConfigMutex.RUnlock()
 
 	buyPrice := 0.0
@@ -166,13 +528,13 @@ func (a *ArbServiceImpl) IsProfit(price1, price2 float64) bool {
 	if price1 > price2 {
 		buyPrice = price2
 		sellPrice = price1
-		buyFee = a.dex2.GetPoolFee()
-		sellFee = a.dex1.GetPoolFee()
+		buyFee = a.dex2.GetPoolFee(symbol)
+		sellFee = a.dex1.GetPoolFee(symbol)
 	} else {
 		buyPrice = price1
 		sellPrice = price2
-		sellFee = a.dex2.GetPoolFee()
-		buyFee = a.dex1.GetPoolFee()
+		sellFee = a.dex2.GetPoolFee(symbol)
+		buyFee = a.dex1.GetPoolFee(symbol)
 	}
 	// -------BUYING (e.g., USDC -> WETH) ---------//
 	// The fee is taken from the input asset (USDC) BEFORE the swap.
@@ -193,7 +555,7 @@ func (a *ArbServiceImpl) IsProfit(price1, price2 float64) bool {
 	// This means `Profit` is the amount of USDC you make after all fees and gas.
 	// If `Profit` is greater than or equal to `profitThreshold`, it's profitable.
 
-	Profit := finalUsdcAmount - amountSize - a.orderConfig.TotalGasCost
+	Profit := finalUsdcAmount - amountSize - totalGasCost
 
 	fmt.Println("----------------------------------------------------")
 	slog.Info("Profit calculation (in USDC)",
@@ -207,7 +569,7 @@ func (a *ArbServiceImpl) IsProfit(price1, price2 float64) bool {
 		"buyFee", buyFee,
 		"sellFee", sellFee,
 		"Profit", Profit,
-		"profitThreshold", a.orderConfig.ProfitThreshold)
+		"profitThreshold", profitThreshold)
 	fmt.Println("----------------------------------------------------")
 	return Profit >= profitThreshold
 }
@@ -1,46 +1,78 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"math"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/sagarkarki99/arbitrator/dex"
 )
 
+// mockFeeds backs the mocks' price subscriptions with pools that never trade.
+var mockFeeds = dex.NewPriceFeeds(dex.DefaultPriceBuffer)
+
+func idlePool(ctx context.Context, publish func(*dex.Price)) error {
+	return nil
+}
+
 type MockDex1 struct {
 }
 
-func (m1 MockDex1) GetPrice(symbol string) (<-chan *dex.Price, error) {
-	return nil, nil
+func (m1 MockDex1) GetPrice(ctx context.Context, symbol string) (*dex.PriceSubscription, error) {
+	return mockFeeds.Subscribe(ctx, "Mock1 "+symbol, idlePool)
+}
+
+func (m1 MockDex1) PriceAt(ctx context.Context, symbol string, block uint64) (*dex.Price, error) {
+	return &dex.Price{Pool: "Mock1", Symbol: symbol, Price: 1.0, BlockNumber: block}, nil
 }
 
-func (m1 MockDex1) GetPoolFee() float64 {
+func (m1 MockDex1) GetPoolFee(symbol string) float64 {
 	return 0.003
 }
 
-func (m1 MockDex1) Buy(amount float64, symbol string) (string, error) {
-	return "", nil
+func (m1 MockDex1) Buy(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*dex.SwapResult, error) {
+	return &dex.SwapResult{}, nil
 }
-func (m1 MockDex1) Sell(amount float64, symbol string) (string, error) {
-	return "", nil
+func (m1 MockDex1) Sell(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*dex.SwapResult, error) {
+	return &dex.SwapResult{}, nil
+}
+func (m1 MockDex1) SimulateBuy(ctx context.Context, from common.Address, amount float64, symbol string) (*dex.SwapSimulation, error) {
+	return &dex.SwapSimulation{Pool: "Mock1", Symbol: symbol, AmountOutReadable: amount / 0.001}, nil
+}
+func (m1 MockDex1) SimulateSell(ctx context.Context, from common.Address, amount float64, symbol string) (*dex.SwapSimulation, error) {
+	return &dex.SwapSimulation{Pool: "Mock1", Symbol: symbol, AmountOutReadable: amount * 0.001}, nil
 }
 
 type MockDex2 struct {
 }
 
-func (m1 MockDex2) GetPrice(symbol string) (<-chan *dex.Price, error) {
-	return nil, nil
+func (m1 MockDex2) GetPrice(ctx context.Context, symbol string) (*dex.PriceSubscription, error) {
+	return mockFeeds.Subscribe(ctx, "Mock2 "+symbol, idlePool)
+}
+
+func (m1 MockDex2) PriceAt(ctx context.Context, symbol string, block uint64) (*dex.Price, error) {
+	return &dex.Price{Pool: "Mock2", Symbol: symbol, Price: 2.0, BlockNumber: block}, nil
 }
 
-func (m1 MockDex2) GetPoolFee() float64 {
+func (m1 MockDex2) GetPoolFee(symbol string) float64 {
 	return 0.0025
 }
 
-func (m1 MockDex2) Buy(amount float64, symbol string) (string, error) {
-	return "", nil
+func (m1 MockDex2) Buy(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*dex.SwapResult, error) {
+	return &dex.SwapResult{}, nil
 }
-func (m1 MockDex2) Sell(amount float64, symbol string) (string, error) {
-	return "", nil
+func (m1 MockDex2) Sell(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*dex.SwapResult, error) {
+	return &dex.SwapResult{}, nil
+}
+func (m1 MockDex2) SimulateBuy(ctx context.Context, from common.Address, amount float64, symbol string) (*dex.SwapSimulation, error) {
+	return &dex.SwapSimulation{Pool: "Mock2", Symbol: symbol, Reverted: true, RevertReason: "SPL"}, nil
+}
+func (m1 MockDex2) SimulateSell(ctx context.Context, from common.Address, amount float64, symbol string) (*dex.SwapSimulation, error) {
+	return &dex.SwapSimulation{Pool: "Mock2", Symbol: symbol, AmountOutReadable: amount * 0.0011}, nil
 }
 
 // Testing for USDT denominated pool i.e for eg: WBNB/USDT
@@ -238,3 +270,390 @@ func TestIsSpreadProfitable_AsFalse(t *testing.T) {
 	}
 
 }
+
+func TestSimulateArbitrage_Profit(t *testing.T) {
+	// Arrange
+	arbService := &ArbServiceImpl{
+		dex1:        MockDex1{},
+		dex2:        MockDex2{},
+		ConfigMutex: &sync.RWMutex{},
+		orderConfig: OrderConfig{
+			AmountSize:      100.0,
+			ProfitThreshold: 5.0,
+			TotalGasCost:    0.5,
+			ActiveSymbol:    "WBNB/USDT",
+		},
+	}
+
+	// Act
+	// buy 100 USDT worth at 0.001 => 100000 WBNB, sell at 0.0011 => 110 USDT
+	sim, err := arbService.simulateArbitrage(context.Background(), MockDex1{}, MockDex2{}, "WBNB/USDT", 100.0)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if math.Abs(sim.Profit-9.5) > 1e-9 {
+		t.Errorf("Expected simulated profit 9.5, got %f", sim.Profit)
+	}
+}
+
+func TestSimulateArbitrage_BuyReverted(t *testing.T) {
+	// Arrange
+	arbService := &ArbServiceImpl{
+		dex1:        MockDex1{},
+		dex2:        MockDex2{},
+		ConfigMutex: &sync.RWMutex{},
+		orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0},
+	}
+
+	// Act
+	sim, err := arbService.simulateArbitrage(context.Background(), MockDex2{}, MockDex1{}, "WBNB/USDT", 100.0)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !sim.Buy.Reverted || sim.Buy.RevertReason != "SPL" {
+		t.Errorf("Expected buy leg to revert with SPL, got %+v", sim.Buy)
+	}
+	if sim.Profit >= arbService.orderConfig.ProfitThreshold {
+		t.Errorf("Expected reverted simulation to fall below threshold, got %f", sim.Profit)
+	}
+}
+
+type countingDex struct {
+	MockDex1
+	buys       int
+	boughtFor  float64
+	boughtFrom common.Address
+	// minimumOut is the guaranteed output its buys report.
+	minimumOut float64
+}
+
+func (c *countingDex) Buy(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*dex.SwapResult, error) {
+	c.buys++
+	c.boughtFor = amount
+	c.boughtFrom = from
+	return &dex.SwapResult{AmountOutMinimumReadable: c.minimumOut}, nil
+}
+
+// sellingDex records the amount and account its sell leg is sent with.
+type sellingDex struct {
+	MockDex2
+	soldFor  float64
+	soldFrom common.Address
+}
+
+func (s *sellingDex) Sell(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*dex.SwapResult, error) {
+	s.soldFor = amount
+	s.soldFrom = from
+	return &dex.SwapResult{}, nil
+}
+
+func TestPerformArbitrageTransaction_SellsGuaranteedBuyOutput(t *testing.T) {
+	// Arrange
+	buyDex := &countingDex{minimumOut: 99900}
+	sellDex := &sellingDex{}
+	arbService := &ArbServiceImpl{
+		dex1:        buyDex,
+		dex2:        sellDex,
+		ConfigMutex: &sync.RWMutex{},
+		orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0, Slippage: 0.001},
+	}
+
+	// Act
+	// The buy simulates 100000 WBNB but only guarantees 99900.
+	arbService.performArbitrageTransaction(context.Background(), 1.0, 2.0, "WBNB/USDT", 1)
+
+	// Assert
+	if sellDex.soldFor != 99900 {
+		t.Errorf("Expected the sell leg to spend the guaranteed 99900, got %v", sellDex.soldFor)
+	}
+}
+
+func TestPerformArbitrageTransaction_TradesFromChosenAccount(t *testing.T) {
+	// Arrange
+	account := common.HexToAddress("0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0")
+	buyDex := &countingDex{minimumOut: 99900}
+	sellDex := &sellingDex{}
+	arbService := &ArbServiceImpl{
+		dex1:        buyDex,
+		dex2:        sellDex,
+		account:     account,
+		ConfigMutex: &sync.RWMutex{},
+		orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0, Slippage: 0.001},
+	}
+
+	// Act
+	arbService.performArbitrageTransaction(context.Background(), 1.0, 2.0, "WBNB/USDT", 1)
+
+	// Assert
+	if buyDex.boughtFrom != account || sellDex.soldFrom != account {
+		t.Errorf("Expected both legs from %s, got %s and %s", account.Hex(), buyDex.boughtFrom.Hex(), sellDex.soldFrom.Hex())
+	}
+}
+
+// lockCheckingDex records whether sends was held when its legs were sent.
+type lockCheckingDex struct {
+	MockDex1
+	sends         *sync.Mutex
+	sent          bool
+	sentUnguarded bool
+}
+
+func (l *lockCheckingDex) Buy(ctx context.Context, from common.Address, amount float64, symbol string, slippage float64) (*dex.SwapResult, error) {
+	l.sent = true
+	if l.sends.TryLock() {
+		l.sentUnguarded = true
+		l.sends.Unlock()
+	}
+	return &dex.SwapResult{AmountOutMinimumReadable: 99900}, nil
+}
+
+func TestPerformArbitrageTransaction_HoldsSendsWhileSending(t *testing.T) {
+	// Arrange
+	sends := &sync.Mutex{}
+	buyDex := &lockCheckingDex{sends: sends}
+	arbService := &ArbServiceImpl{
+		dex1:        buyDex,
+		dex2:        &sellingDex{},
+		sends:       sends,
+		ConfigMutex: &sync.RWMutex{},
+		orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0, Slippage: 0.001},
+	}
+
+	// Act
+	arbService.performArbitrageTransaction(context.Background(), 1.0, 2.0, "WBNB/USDT", 1)
+
+	// Assert
+	if !buyDex.sent {
+		t.Fatalf("Expected the buy leg to be sent")
+	}
+	if buyDex.sentUnguarded {
+		t.Errorf("Expected the buy leg to be sent while sends is held")
+	}
+	if !sends.TryLock() {
+		t.Errorf("Expected sends to be released after the arbitrage")
+	}
+}
+
+type stubApprovals struct {
+	err error
+}
+
+func (s stubApprovals) EnsureApprovals(ctx context.Context, owner common.Address, symbol string) error {
+	return s.err
+}
+
+func TestPerformArbitrageTransaction_RequiresApprovals(t *testing.T) {
+	tests := []struct {
+		name         string
+		approvals    ApprovalChecker
+		expectedBuys int
+	}{
+		{"approved", stubApprovals{}, 1},
+		{"missing approval", stubApprovals{err: errors.New("allowance too low")}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			buyDex := &countingDex{}
+			arbService := &ArbServiceImpl{
+				dex1:        buyDex,
+				dex2:        MockDex2{},
+				approvals:   tt.approvals,
+				ConfigMutex: &sync.RWMutex{},
+				orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0, Slippage: 0.001},
+			}
+
+			// Act
+			arbService.performArbitrageTransaction(context.Background(), 1.0, 2.0, "WBNB/USDT", 1)
+
+			// Assert
+			if buyDex.buys != tt.expectedBuys {
+				t.Errorf("Expected %d buys, got %d", tt.expectedBuys, buyDex.buys)
+			}
+		})
+	}
+}
+
+type stubInventory struct {
+	base, quote float64
+	reserved    []float64
+	tracked     int
+}
+
+func (s *stubInventory) Available(symbol string) (float64, float64, error) {
+	return s.base, s.quote, nil
+}
+
+func (s *stubInventory) Reserve(symbol string, base, quote float64) (*Reservation, error) {
+	s.reserved = []float64{base, quote}
+	return &Reservation{}, nil
+}
+
+func (s *stubInventory) TrackTrade(ctx context.Context, reservation *Reservation, hashes ...string) {
+	s.tracked++
+}
+
+func TestPerformArbitrageTransaction_SizesToInventory(t *testing.T) {
+	tests := []struct {
+		name         string
+		inventory    *stubInventory
+		expectedBuys int
+		expectedSize float64
+	}{
+		{"enough inventory", &stubInventory{base: 200000, quote: 500}, 1, 100},
+		{"little quote", &stubInventory{base: 200000, quote: 60}, 1, 60},
+		{"no base to sell", &stubInventory{base: 0, quote: 500}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			buyDex := &countingDex{}
+			arbService := &ArbServiceImpl{
+				dex1:        buyDex,
+				dex2:        MockDex2{},
+				inventory:   tt.inventory,
+				ConfigMutex: &sync.RWMutex{},
+				orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0, Slippage: 0.001},
+			}
+
+			// Act
+			arbService.performArbitrageTransaction(context.Background(), 1.0, 2.0, "WBNB/USDT", 1)
+
+			// Assert
+			if buyDex.buys != tt.expectedBuys {
+				t.Fatalf("Expected %d buys, got %d", tt.expectedBuys, buyDex.buys)
+			}
+			if tt.expectedBuys == 0 {
+				return
+			}
+			if math.Abs(buyDex.boughtFor-tt.expectedSize) > 1e-9 {
+				t.Errorf("Expected a buy of %v, got %v", tt.expectedSize, buyDex.boughtFor)
+			}
+			if tt.inventory.reserved[1] != buyDex.boughtFor || tt.inventory.tracked != 1 {
+				t.Errorf("Expected the buy to be reserved and tracked, got %v reserved and %d tracked", tt.inventory.reserved, tt.inventory.tracked)
+			}
+		})
+	}
+}
+
+// blockDex records the blocks its prices are read at.
+type blockDex struct {
+	countingDex
+	blocks []uint64
+	err    error
+}
+
+func (b *blockDex) PriceAt(ctx context.Context, symbol string, block uint64) (*dex.Price, error) {
+	b.blocks = append(b.blocks, block)
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.countingDex.PriceAt(ctx, symbol, block)
+}
+
+func TestLookOpportunityOnBlocks_EvaluatesEachBlockSnapshot(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectedBuys int
+	}{
+		{"prices read", nil, 2},
+		{"price unavailable", errors.New("missing trie node"), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			buyDex := &blockDex{err: tt.err}
+			arbService := &ArbServiceImpl{
+				dex1:        buyDex,
+				dex2:        MockDex2{},
+				ConfigMutex: &sync.RWMutex{},
+				orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0, Slippage: 0.001, ActiveSymbol: "WBNB/USDT"},
+			}
+			heads := make(chan uint64, 2)
+			heads <- 41
+			heads <- 42
+			close(heads)
+
+			// Act
+			arbService.LookOpportunityOnBlocks(context.Background(), heads)
+
+			// Assert
+			if len(buyDex.blocks) != 2 || buyDex.blocks[0] != 41 || buyDex.blocks[1] != 42 {
+				t.Errorf("Expected prices read at blocks 41 and 42, got %v", buyDex.blocks)
+			}
+			if buyDex.buys != tt.expectedBuys {
+				t.Errorf("Expected %d buys, got %d", tt.expectedBuys, buyDex.buys)
+			}
+		})
+	}
+}
+
+func TestCheckFreshness(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	at := func(block uint64, age time.Duration) *dex.Price {
+		return &dex.Price{Pool: "Mock", BlockNumber: block, BlockTimestamp: now.Add(-age)}
+	}
+	tests := []struct {
+		name           string
+		price1, price2 *dex.Price
+		expectStale    bool
+	}{
+		{"same block", at(100, time.Second), at(100, time.Second), false},
+		{"within distance", at(100, 3*time.Second), at(102, time.Second), false},
+		{"too many blocks apart", at(100, 3*time.Second), at(103, time.Second), true},
+		{"too old", at(100, 31*time.Second), at(100, 31*time.Second), true},
+		{"age by receive time", &dex.Price{BlockNumber: 100, ReceivedAt: now.Add(-time.Minute)}, at(100, 0), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			arbService := &ArbServiceImpl{
+				ConfigMutex: &sync.RWMutex{},
+				orderConfig: OrderConfig{MaxPriceAgeSeconds: 30, MaxBlockDistance: 2},
+			}
+
+			// Act
+			err := arbService.checkFreshness(tt.price1, tt.price2, now)
+
+			// Assert
+			if (err != nil) != tt.expectStale {
+				t.Errorf("Expected stale %v, got %v", tt.expectStale, err)
+			}
+		})
+	}
+}
+
+func TestStart_ReturnsOnCancel(t *testing.T) {
+	// Arrange
+	arbService := &ArbServiceImpl{
+		dex1:        MockDex1{},
+		dex2:        MockDex2{},
+		ConfigMutex: &sync.RWMutex{},
+		orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0, ActiveSymbol: "WBNB/USDT"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		arbService.Start(ctx)
+		close(stopped)
+	}()
+
+	// Act
+	cancel()
+
+	// Assert
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected Start to return after cancellation")
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// LoadOrderConfig reads and validates an order configuration JSON file.
+func LoadOrderConfig(path string) (OrderConfig, error) {
+	var config OrderConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read order config: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("failed to decode order config %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid order config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ConfigWatcher reloads the order configuration of an ArbService whenever the
+// config file changes or the process receives SIGHUP.
+type ConfigWatcher struct {
+	path    string
+	service ArbService
+}
+
+func NewConfigWatcher(path string, service ArbService) *ConfigWatcher {
+	return &ConfigWatcher{path: path, service: service}
+}
+
+// Watch blocks until ctx is cancelled. The file's directory is watched rather
+// than the file itself so that editors replacing the file are picked up.
+func (w *ConfigWatcher) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(w.path)); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", w.path, err)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	slog.Info("Watching order config", "path", w.path)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hangup:
+			slog.Info("SIGHUP received, reloading order config", "path", w.path)
+			w.Reload()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(w.path) {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				w.Reload()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("Order config watcher error", "error", err)
+		}
+	}
+}
+
+// Reload reads the config file and applies it when it is valid. The running
+// configuration is kept on any error.
+func (w *ConfigWatcher) Reload() error {
+	newConfig, err := LoadOrderConfig(w.path)
+	if err != nil {
+		slog.Error("Rejected order config reload", "error", err)
+		return err
+	}
+
+	oldConfig := w.service.GetConfig()
+	// Subscriptions are made for the symbol at start, so it cannot change live.
+	if newConfig.ActiveSymbol != oldConfig.ActiveSymbol {
+		err := fmt.Errorf("activeSymbol cannot change from %s to %s without a restart", oldConfig.ActiveSymbol, newConfig.ActiveSymbol)
+		slog.Error("Rejected order config reload", "error", err)
+		return err
+	}
+
+	changes := diffOrderConfig(oldConfig, newConfig)
+	if len(changes) == 0 {
+		slog.Info("Order config unchanged", "path", w.path)
+		return nil
+	}
+	if err := w.service.SetConfig(newConfig); err != nil {
+		slog.Error("Rejected order config reload", "error", err)
+		return err
+	}
+
+	slog.Info("Order config reloaded", "path", w.path, "changes", changes)
+	return nil
+}
+
+// diffOrderConfig lists every field that differs as "Field: old -> new".
+func diffOrderConfig(oldConfig, newConfig OrderConfig) []string {
+	var changes []string
+	oldValue := reflect.ValueOf(oldConfig)
+	newValue := reflect.ValueOf(newConfig)
+	for i := 0; i < oldValue.NumField(); i++ {
+		before, after := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if before != after {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", oldValue.Type().Field(i).Name, before, after))
+		}
+	}
+	return changes
+}
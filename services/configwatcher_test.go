@@ -0,0 +1,90 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func writeOrderConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write order config: %v", err)
+	}
+}
+
+func TestOrderConfigValidate_RejectsInsaneSlippageAndGas(t *testing.T) {
+	// Arrange
+	config := DefaultOrderConfig
+	config.Slippage = 1
+	config.TotalGasCost = config.AmountSize
+
+	// Act
+	err := config.Validate()
+
+	// Assert
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+}
+
+func TestConfigWatcherReload_AppliesValidConfig(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "order.json")
+	writeOrderConfig(t, path, `{"amountSize": 50, "profitThreshold": 0.1, "slippage": 0.002, "totalGasCost": 0.0001, "activeSymbol": "CAKE/USDT"}`)
+	service := &ArbServiceImpl{ConfigMutex: &sync.RWMutex{}, orderConfig: DefaultOrderConfig}
+	watcher := NewConfigWatcher(path, service)
+
+	// Act
+	err := watcher.Reload()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected reload to succeed, got %v", err)
+	}
+	if got := service.GetConfig(); got.AmountSize != 50 || got.Slippage != 0.002 {
+		t.Errorf("Expected new config to be applied, got %+v", got)
+	}
+}
+
+func TestConfigWatcherReload_KeepsConfigOnInvalidFile(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "order.json")
+	service := &ArbServiceImpl{ConfigMutex: &sync.RWMutex{}, orderConfig: DefaultOrderConfig}
+	watcher := NewConfigWatcher(path, service)
+
+	cases := map[string]string{
+		"invalid values":  `{"amountSize": -1, "profitThreshold": 0.1, "slippage": 0.002, "activeSymbol": "CAKE/USDT"}`,
+		"unknown field":   `{"amountSize": 50, "profitTreshold": 0.1, "activeSymbol": "CAKE/USDT"}`,
+		"symbol switched": `{"amountSize": 50, "profitThreshold": 0.1, "slippage": 0.002, "activeSymbol": "USDT/WBNB"}`,
+	}
+	for name, content := range cases {
+		writeOrderConfig(t, path, content)
+
+		// Act
+		err := watcher.Reload()
+
+		// Assert
+		if err == nil {
+			t.Errorf("%s: expected reload to be rejected", name)
+		}
+		if got := service.GetConfig(); got != DefaultOrderConfig {
+			t.Errorf("%s: expected running config to be kept, got %+v", name, got)
+		}
+	}
+}
+
+func TestDiffOrderConfig(t *testing.T) {
+	// Arrange
+	newConfig := DefaultOrderConfig
+	newConfig.ProfitThreshold = 0.5
+
+	// Act
+	changes := diffOrderConfig(DefaultOrderConfig, newConfig)
+
+	// Assert
+	if len(changes) != 1 || changes[0] != "ProfitThreshold: 0.04 -> 0.5" {
+		t.Errorf("Expected a single ProfitThreshold change, got %v", changes)
+	}
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/keychain"
+)
+
+// TradingGate can hold trading back, e.g. while the account cannot pay for gas.
+type TradingGate interface {
+	// TradingAllowed returns why trading is paused, or nil.
+	TradingAllowed() error
+}
+
+const (
+	defaultGasReserveInterval = 30 * time.Second
+	reserveTxTimeout          = 2 * time.Minute
+)
+
+// GasReserveConfig bounds the native balance kept for gas and the wrapped
+// native buffer kept for trading. Amounts are in wei.
+type GasReserveConfig struct {
+	// MinNative is the gas reserve. Trading pauses while it cannot be kept.
+	MinNative *big.Int
+	// TargetNative is what unwrapping tops the native balance up to.
+	TargetNative *big.Int
+	// Below MinWrapped, native above TargetNative is wrapped up to
+	// TargetWrapped. A zero TargetWrapped never wraps.
+	MinWrapped    *big.Int
+	TargetWrapped *big.Int
+	// Above MaxWrapped, the buffer is unwrapped down to TargetWrapped. nil
+	// never unwraps surplus.
+	MaxWrapped *big.Int
+	Interval   time.Duration
+}
+
+// GasReserveConfigFromEnv reads GAS_RESERVE_MIN, GAS_RESERVE_TARGET,
+// WRAPPED_BUFFER_MIN, WRAPPED_BUFFER_TARGET, WRAPPED_BUFFER_MAX (all wei) and
+// GAS_RESERVE_INTERVAL. The native target defaults to twice the reserve and
+// the wrapped minimum to the wrapped target.
+func GasReserveConfigFromEnv() (GasReserveConfig, error) {
+	config := GasReserveConfig{Interval: defaultGasReserveInterval}
+	var errs []error
+	for _, field := range []struct {
+		name string
+		dst  **big.Int
+	}{
+		{"GAS_RESERVE_MIN", &config.MinNative},
+		{"GAS_RESERVE_TARGET", &config.TargetNative},
+		{"WRAPPED_BUFFER_MIN", &config.MinWrapped},
+		{"WRAPPED_BUFFER_TARGET", &config.TargetWrapped},
+		{"WRAPPED_BUFFER_MAX", &config.MaxWrapped},
+	} {
+		raw := os.Getenv(field.name)
+		if raw == "" {
+			continue
+		}
+		value, ok := new(big.Int).SetString(raw, 10)
+		if !ok || value.Sign() < 0 {
+			errs = append(errs, fmt.Errorf("%s %q is not an amount of wei", field.name, raw))
+			continue
+		}
+		*field.dst = value
+	}
+	if raw := os.Getenv("GAS_RESERVE_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			errs = append(errs, fmt.Errorf("GAS_RESERVE_INTERVAL %q is not a positive duration", raw))
+		}
+		config.Interval = interval
+	}
+	if err := errors.Join(errs...); err != nil {
+		return config, err
+	}
+
+	if config.MinNative == nil {
+		config.MinNative = new(big.Int)
+	}
+	if config.TargetNative == nil {
+		config.TargetNative = new(big.Int).Mul(config.MinNative, big.NewInt(2))
+	}
+	if config.TargetWrapped == nil {
+		config.TargetWrapped = new(big.Int)
+	}
+	if config.MinWrapped == nil {
+		config.MinWrapped = config.TargetWrapped
+	}
+	if config.TargetNative.Cmp(config.MinNative) < 0 {
+		return config, errors.New("GAS_RESERVE_TARGET must not be below GAS_RESERVE_MIN")
+	}
+	if config.MinWrapped.Cmp(config.TargetWrapped) > 0 {
+		return config, errors.New("WRAPPED_BUFFER_MIN must not be above WRAPPED_BUFFER_TARGET")
+	}
+	if config.MaxWrapped != nil && config.MaxWrapped.Cmp(config.TargetWrapped) < 0 {
+		return config, errors.New("WRAPPED_BUFFER_MAX must not be below WRAPPED_BUFFER_TARGET")
+	}
+	return config, nil
+}
+
+// reserveAction is one rebalancing step between native and wrapped native.
+type reserveAction struct {
+	wrap   bool
+	amount *big.Int
+	reason string
+}
+
+// planReserve decides how to rebalance native and wrapped. Keeping the gas
+// reserve comes first; the wrapped buffer only uses native above its target.
+func planReserve(config GasReserveConfig, native, wrapped *big.Int) *reserveAction {
+	if native.Cmp(config.MinNative) < 0 {
+		amount := new(big.Int).Sub(config.TargetNative, native)
+		if amount.Cmp(wrapped) > 0 {
+			amount = new(big.Int).Set(wrapped)
+		}
+		if amount.Sign() <= 0 {
+			return nil
+		}
+		return &reserveAction{amount: amount, reason: "gas reserve low"}
+	}
+	if config.TargetWrapped.Sign() > 0 && wrapped.Cmp(config.MinWrapped) < 0 {
+		amount := new(big.Int).Sub(config.TargetWrapped, wrapped)
+		if spare := new(big.Int).Sub(native, config.TargetNative); amount.Cmp(spare) > 0 {
+			amount = spare
+		}
+		if amount.Sign() <= 0 {
+			return nil
+		}
+		return &reserveAction{wrap: true, amount: amount, reason: "wrapped buffer low"}
+	}
+	if config.MaxWrapped != nil && wrapped.Cmp(config.MaxWrapped) > 0 {
+		return &reserveAction{amount: new(big.Int).Sub(wrapped, config.TargetWrapped), reason: "wrapped buffer above maximum"}
+	}
+	return nil
+}
+
+// GasReserveManager keeps the gas reserve and the wrapped native buffer within
+// their bounds, wrapping with deposit and unwrapping with withdraw. Trading is
+// paused while the gas reserve cannot be kept.
+type GasReserveManager struct {
+	cl      *blockchain.Client
+	kc      keychain.Keychain
+	owner   common.Address
+	wrapped common.Address
+	// sends is shared with the trading service and held while a rebalance is
+	// sent, so the two never pick the same nonce; nil sends unguarded.
+	sends  *sync.Mutex
+	config GasReserveConfig
+
+	mu     sync.Mutex
+	paused error
+}
+
+func NewGasReserveManager(cl *blockchain.Client, kc keychain.Keychain, owner, wrapped common.Address, sends *sync.Mutex, config GasReserveConfig) *GasReserveManager {
+	return &GasReserveManager{cl: cl, kc: kc, owner: owner, wrapped: wrapped, sends: sends, config: config}
+}
+
+// TradingAllowed returns why trading is paused, or nil.
+func (m *GasReserveManager) TradingAllowed() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
+
+// Run checks the balances every interval until ctx is cancelled. Callers run
+// Check once themselves to know the state before trading starts.
+func (m *GasReserveManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Check(ctx); err != nil {
+				slog.Error("Gas reserve check failed", "error", err)
+			}
+		}
+	}
+}
+
+// Check reads the balances, rebalances once if needed and pauses or resumes
+// trading depending on the gas reserve.
+func (m *GasReserveManager) Check(ctx context.Context) error {
+	native, wrapped, err := m.balances(ctx)
+	if err != nil {
+		m.pause(fmt.Errorf("gas reserve unknown: %w", err))
+		return err
+	}
+
+	var actionErr error
+	if action := planReserve(m.config, native, wrapped); action != nil {
+		slog.Info("Rebalancing native and wrapped native",
+			"reason", action.reason,
+			"wrap", action.wrap,
+			"amount", action.amount,
+			"native", native,
+			"wrapped", wrapped)
+		if actionErr = m.execute(ctx, action); actionErr == nil {
+			if native, wrapped, err = m.balances(ctx); err != nil {
+				m.pause(fmt.Errorf("gas reserve unknown: %w", err))
+				return err
+			}
+		}
+	}
+
+	if native.Cmp(m.config.MinNative) < 0 {
+		m.pause(fmt.Errorf("native balance %s is below the gas reserve of %s wei", native, m.config.MinNative))
+	} else {
+		m.resume()
+	}
+	return actionErr
+}
+
+func (m *GasReserveManager) balances(ctx context.Context) (native, wrapped *big.Int, err error) {
+	if native, err = keychain.GetNativeBalance(ctx, m.owner.Hex(), m.cl); err != nil {
+		return nil, nil, err
+	}
+	if wrapped, err = keychain.GetBalance(ctx, m.owner.Hex(), m.wrapped.Hex(), m.cl); err != nil {
+		return nil, nil, err
+	}
+	return native, wrapped, nil
+}
+
+// execute sends the deposit or withdraw and waits until it is mined.
+func (m *GasReserveManager) execute(ctx context.Context, action *reserveAction) error {
+	tx, err := m.send(ctx, action)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reserveTxTimeout)
+	defer cancel()
+	receipt, err := bind.WaitMined(ctx, m.cl, tx)
+	if err != nil {
+		return fmt.Errorf("failed waiting for %s: %w", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("%s reverted", tx.Hash().Hex())
+	}
+	slog.Info("Rebalance confirmed", "hash", tx.Hash().Hex(), "block", receipt.BlockNumber)
+	return nil
+}
+
+// send sends the deposit or withdraw while no trade is being sent. Once it is
+// pending, later sends pick the next nonce, so it is not waited for.
+func (m *GasReserveManager) send(ctx context.Context, action *reserveAction) (*types.Transaction, error) {
+	if m.sends != nil {
+		m.sends.Lock()
+		defer m.sends.Unlock()
+	}
+	if action.wrap {
+		return keychain.WrapNative(ctx, m.owner, action.amount, m.wrapped.Hex(), m.cl, m.kc)
+	}
+	return keychain.UnwrapNative(ctx, m.owner, action.amount, m.wrapped.Hex(), m.cl, m.kc)
+}
+
+func (m *GasReserveManager) pause(reason error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.paused == nil {
+		slog.Warn("Pausing trading", "reason", reason)
+	}
+	m.paused = reason
+}
+
+func (m *GasReserveManager) resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.paused != nil {
+		slog.Info("Gas reserve restored, resuming trading")
+	}
+	m.paused = nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+func TestPlanReserve(t *testing.T) {
+	config := GasReserveConfig{
+		MinNative:     big.NewInt(100),
+		TargetNative:  big.NewInt(200),
+		MinWrapped:    big.NewInt(500),
+		TargetWrapped: big.NewInt(1000),
+		MaxWrapped:    big.NewInt(2000),
+	}
+	tests := []struct {
+		name            string
+		native, wrapped int64
+		expectedWrap    bool
+		expectedAmount  int64
+	}{
+		{"balanced", 150, 800, false, 0},
+		{"gas low unwraps to target", 50, 800, false, 150},
+		{"gas low unwraps what is left", 50, 40, false, 40},
+		{"buffer low wraps spare native", 1000, 100, true, 800},
+		{"buffer low keeps native target", 400, 100, true, 200},
+		{"buffer high unwraps to target", 150, 2500, false, 1500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			action := planReserve(config, big.NewInt(tt.native), big.NewInt(tt.wrapped))
+
+			// Assert
+			if tt.expectedAmount == 0 {
+				if action != nil {
+					t.Errorf("Expected no action, got %+v", action)
+				}
+				return
+			}
+			if action == nil {
+				t.Fatalf("Expected an action of %d, got none", tt.expectedAmount)
+			}
+			if action.wrap != tt.expectedWrap || action.amount.Cmp(big.NewInt(tt.expectedAmount)) != 0 {
+				t.Errorf("Expected wrap=%t amount=%d, got wrap=%t amount=%s", tt.expectedWrap, tt.expectedAmount, action.wrap, action.amount)
+			}
+		})
+	}
+}
+
+type stubGate struct {
+	err error
+}
+
+func (s stubGate) TradingAllowed() error {
+	return s.err
+}
+
+func TestPerformArbitrageTransaction_RespectsTradingGate(t *testing.T) {
+	// Arrange
+	buyDex := &countingDex{}
+	arbService := &ArbServiceImpl{
+		dex1:        buyDex,
+		dex2:        MockDex2{},
+		gate:        stubGate{err: errors.New("gas reserve low")},
+		ConfigMutex: &sync.RWMutex{},
+		orderConfig: OrderConfig{AmountSize: 100.0, ProfitThreshold: 5.0, Slippage: 0.001},
+	}
+
+	// Act
+	arbService.performArbitrageTransaction(context.Background(), 1.0, 2.0, "WBNB/USDT", 1)
+
+	// Assert
+	if buyDex.buys != 0 {
+		t.Errorf("Expected no buys while paused, got %d", buyDex.buys)
+	}
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/contracts"
+	"github.com/sagarkarki99/arbitrator/dex"
+	"github.com/sagarkarki99/arbitrator/keychain"
+)
+
+// InventoryChecker tells the strategy what the trading account can spend and
+// holds amounts for trades that are in flight.
+type InventoryChecker interface {
+	// Available returns the spendable base (token0) and quote (token1)
+	// amounts of symbol, net of reservations.
+	Available(symbol string) (base, quote float64, err error)
+	// Reserve holds base and quote of symbol for one trade.
+	Reserve(symbol string, base, quote float64) (*Reservation, error)
+	// TrackTrade releases reservation once every hash is final.
+	TrackTrade(ctx context.Context, reservation *Reservation, hashes ...string)
+}
+
+// TokenBalance is the trading account's holding of one token.
+type TokenBalance struct {
+	Token    common.Address
+	Symbol   string
+	Decimals int
+	Balance  *big.Int
+	// Reserved is held by trades that have not been mined yet.
+	Reserved  *big.Int
+	UpdatedAt time.Time
+}
+
+// Available is the balance not held by any reservation.
+func (b TokenBalance) Available() *big.Int {
+	available := new(big.Int).Sub(b.Balance, b.Reserved)
+	if available.Sign() < 0 {
+		return new(big.Int)
+	}
+	return available
+}
+
+// Reservation holds token amounts for one trade until it is released.
+type Reservation struct {
+	inventory *Inventory
+	amounts   map[common.Address]*big.Int
+	released  bool
+}
+
+// Release returns the reserved amounts to the available inventory. It is safe
+// to call more than once.
+func (r *Reservation) Release() {
+	i := r.inventory
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if r.released {
+		return
+	}
+	r.released = true
+	for token, amount := range r.amounts {
+		if balance, ok := i.tokens[token]; ok {
+			balance.Reserved.Sub(balance.Reserved, amount)
+		}
+	}
+}
+
+// Inventory keeps the trading account's balances of every tracked token. They
+// are loaded from the chain, re-read whenever an ERC20 Transfer touches the
+// account and after every tracked trade is final.
+type Inventory struct {
+	cl      *blockchain.Client
+	owner   common.Address
+	tracker *TradeTracker
+
+	mu     sync.Mutex
+	tokens map[common.Address]*TokenBalance
+	native *big.Int
+}
+
+// NewInventory keeps owner's balances; trades are followed until they have
+// confirmations blocks on top of them.
+func NewInventory(cl *blockchain.Client, owner common.Address, confirmations uint64) *Inventory {
+	return &Inventory{
+		cl:      cl,
+		owner:   owner,
+		tracker: NewTradeTracker(cl, confirmations),
+		tokens:  make(map[common.Address]*TokenBalance),
+		native:  new(big.Int),
+	}
+}
+
+// Track adds both tokens of symbol and loads their balances.
+func (i *Inventory) Track(ctx context.Context, symbol string) error {
+	base, quote, err := dex.SymbolTokens(symbol)
+	if err != nil {
+		return err
+	}
+	i.mu.Lock()
+	for _, token := range []dex.Token{base, quote} {
+		if _, ok := i.tokens[token.Contract]; !ok {
+			i.tokens[token.Contract] = &TokenBalance{
+				Token:    token.Contract,
+				Symbol:   token.Symbol,
+				Decimals: token.Decimals,
+				Balance:  new(big.Int),
+				Reserved: new(big.Int),
+			}
+		}
+	}
+	i.mu.Unlock()
+	return i.Refresh(ctx)
+}
+
+// Refresh re-reads the native balance and the balance of every tracked token.
+func (i *Inventory) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, token := range i.trackedTokens() {
+		if err := i.refreshToken(ctx, token); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	native, err := keychain.GetNativeBalance(ctx, i.owner.Hex(), i.cl)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		i.mu.Lock()
+		i.native = native
+		i.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (i *Inventory) refreshToken(ctx context.Context, token common.Address) error {
+	balance, err := keychain.GetBalance(ctx, i.owner.Hex(), token.Hex(), i.cl)
+	if err != nil {
+		return fmt.Errorf("token %s: %w", token.Hex(), err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if tracked, ok := i.tokens[token]; ok {
+		tracked.Balance = balance
+		tracked.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (i *Inventory) trackedTokens() []common.Address {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	tokens := make([]common.Address, 0, len(i.tokens))
+	for token := range i.tokens {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// Resubscription backoff bounds of the transfer watch. The delay doubles
+// after every failed attempt and starts over once transfers are watched.
+var (
+	minResubscribeDelay = 500 * time.Millisecond
+	maxResubscribeDelay = 30 * time.Second
+)
+
+// Watch re-reads a token's balance whenever a Transfer from or to the
+// account is seen. When a subscription fails, every balance is re-read and
+// the transfers are subscribed to again with exponential backoff. Without a
+// websocket endpoint every balance is re-read on each new block instead. It
+// blocks until ctx is cancelled.
+func (i *Inventory) Watch(ctx context.Context) {
+	delay := minResubscribeDelay
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			slog.Info("Resubscribing to inventory transfers", "account", i.owner.Hex(), "attempt", attempt, "delay", delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxResubscribeDelay)
+			// Transfers may have been missed while unsubscribed.
+			if err := i.Refresh(ctx); err != nil {
+				slog.Error("Failed to refresh inventory", "error", err)
+			}
+		}
+
+		watched, err := i.watchTransfers(ctx)
+		if errors.Is(err, blockchain.ErrNoWebsocket) {
+			i.refreshOnHeads(ctx)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if watched {
+			delay = minResubscribeDelay
+		}
+		slog.Error("Inventory transfer subscription failed", "account", i.owner.Hex(), "error", err)
+	}
+}
+
+// watchTransfers refreshes balances on the account's transfers until ctx is
+// cancelled or a subscription fails. watched reports whether every
+// subscription was established.
+func (i *Inventory) watchTransfers(ctx context.Context) (watched bool, err error) {
+	transfers := make(chan *contracts.ERC20Transfer)
+	var subs []event.Subscription
+	defer func() {
+		for _, sub := range subs {
+			sub.Unsubscribe()
+		}
+	}()
+
+	owner := []common.Address{i.owner}
+	for _, token := range i.trackedTokens() {
+		erc20, err := contracts.NewERC20(token, i.cl)
+		if err != nil {
+			return false, fmt.Errorf("failed to create ERC20 contract: %w", err)
+		}
+		// Topic filters are ANDed, so outgoing and incoming transfers need
+		// their own subscription.
+		outgoing, err := erc20.WatchTransfer(&bind.WatchOpts{Context: ctx}, transfers, owner, nil)
+		if err != nil {
+			return false, fmt.Errorf("failed to watch transfers of %s: %w", token.Hex(), err)
+		}
+		subs = append(subs, outgoing)
+		incoming, err := erc20.WatchTransfer(&bind.WatchOpts{Context: ctx}, transfers, nil, owner)
+		if err != nil {
+			return false, fmt.Errorf("failed to watch transfers of %s: %w", token.Hex(), err)
+		}
+		subs = append(subs, incoming)
+	}
+
+	errs := make(chan error, len(subs))
+	for _, sub := range subs {
+		go func(sub event.Subscription) {
+			if err, ok := <-sub.Err(); ok && err != nil {
+				errs <- err
+			}
+		}(sub)
+	}
+
+	slog.Info("Watching inventory transfers", "account", i.owner.Hex(), "tokens", len(subs)/2)
+	for {
+		select {
+		case <-ctx.Done():
+			return true, nil
+		case err := <-errs:
+			return true, fmt.Errorf("transfer subscription failed: %w", err)
+		case transfer := <-transfers:
+			if err := i.refreshToken(ctx, transfer.Raw.Address); err != nil {
+				slog.Error("Failed to refresh balance after transfer", "error", err)
+				continue
+			}
+			slog.Info("Inventory updated by transfer",
+				"token", transfer.Raw.Address.Hex(),
+				"from", transfer.Src.Hex(),
+				"to", transfer.Dst.Hex(),
+				"amount", transfer.Wad,
+				"hash", transfer.Raw.TxHash.Hex())
+		}
+	}
+}
+
+// refreshOnHeads re-reads every balance once per new block until ctx is
+// cancelled, for networks whose transfers cannot be subscribed to.
+func (i *Inventory) refreshOnHeads(ctx context.Context) {
+	slog.Info("Refreshing inventory on every block, transfers cannot be watched", "account", i.owner.Hex())
+	for block := range i.cl.WatchHeads(ctx) {
+		if err := i.Refresh(ctx); err != nil {
+			slog.Error("Failed to refresh inventory", "block", block, "error", err)
+		}
+	}
+}
+
+// Available returns the spendable amounts of symbol's base and quote token.
+func (i *Inventory) Available(symbol string) (base, quote float64, err error) {
+	baseToken, quoteToken, err := dex.SymbolTokens(symbol)
+	if err != nil {
+		return 0, 0, err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	baseBalance, ok := i.tokens[baseToken.Contract]
+	if !ok {
+		return 0, 0, fmt.Errorf("%s is not tracked", baseToken.Symbol)
+	}
+	quoteBalance, ok := i.tokens[quoteToken.Contract]
+	if !ok {
+		return 0, 0, fmt.Errorf("%s is not tracked", quoteToken.Symbol)
+	}
+	return dex.FromTokenUnits(baseBalance.Available(), baseBalance.Decimals),
+		dex.FromTokenUnits(quoteBalance.Available(), quoteBalance.Decimals), nil
+}
+
+// Reserve holds base and quote of symbol, failing when either exceeds what is
+// available.
+func (i *Inventory) Reserve(symbol string, base, quote float64) (*Reservation, error) {
+	baseToken, quoteToken, err := dex.SymbolTokens(symbol)
+	if err != nil {
+		return nil, err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	amounts := make(map[common.Address]*big.Int, 2)
+	for _, want := range []struct {
+		token  dex.Token
+		amount float64
+	}{{baseToken, base}, {quoteToken, quote}} {
+		balance, ok := i.tokens[want.token.Contract]
+		if !ok {
+			return nil, fmt.Errorf("%s is not tracked", want.token.Symbol)
+		}
+		amount := dex.ToTokenUnits(want.amount, balance.Decimals)
+		if amount.Cmp(balance.Available()) > 0 {
+			return nil, fmt.Errorf("insufficient %s: want %v, available %v", want.token.Symbol,
+				want.amount, dex.FromTokenUnits(balance.Available(), balance.Decimals))
+		}
+		amounts[want.token.Contract] = amount
+	}
+	for token, amount := range amounts {
+		i.tokens[token].Reserved.Add(i.tokens[token].Reserved, amount)
+	}
+	return &Reservation{inventory: i, amounts: amounts}, nil
+}
+
+// TrackTrade refreshes the balances once every hash is final and then
+// releases reservation.
+func (i *Inventory) TrackTrade(ctx context.Context, reservation *Reservation, hashes ...string) {
+	txHashes := make([]common.Hash, 0, len(hashes))
+	for _, hash := range hashes {
+		txHashes = append(txHashes, common.HexToHash(hash))
+	}
+	i.tracker.Track(txHashes, func(err error) {
+		if err != nil {
+			slog.Error("Failed to follow trade", "hashes", hashes, "error", err)
+		}
+		if err := i.Refresh(ctx); err != nil {
+			slog.Error("Failed to refresh inventory after trade", "error", err)
+		}
+		reservation.Release()
+	})
+}
+
+// WaitTrades blocks until every tracked trade is final and the inventory is
+// refreshed after it, or until ctx is cancelled.
+func (i *Inventory) WaitTrades(ctx context.Context) error {
+	return i.tracker.Wait(ctx)
+}
+
+// Balances returns every tracked token, ordered by symbol.
+func (i *Inventory) Balances() []TokenBalance {
+	i.mu.Lock()
+	balances := make([]TokenBalance, 0, len(i.tokens))
+	for _, balance := range i.tokens {
+		copied := *balance
+		copied.Balance = new(big.Int).Set(balance.Balance)
+		copied.Reserved = new(big.Int).Set(balance.Reserved)
+		balances = append(balances, copied)
+	}
+	i.mu.Unlock()
+
+	sort.Slice(balances, func(a, b int) bool { return balances[a].Symbol < balances[b].Symbol })
+	return balances
+}
+
+// Native returns the last known native balance in wei.
+func (i *Inventory) Native() *big.Int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return new(big.Int).Set(i.native)
+}
+
+// Report logs the native balance and every tracked token.
+func (i *Inventory) Report() {
+	slog.Info("Native balance", "account", i.owner.Hex(), "wei", i.Native())
+	for _, balance := range i.Balances() {
+		slog.Info("Token balance",
+			"symbol", balance.Symbol,
+			"token", balance.Token.Hex(),
+			"balance", dex.FromTokenUnits(balance.Balance, balance.Decimals),
+			"reserved", dex.FromTokenUnits(balance.Reserved, balance.Decimals),
+			"updatedAt", balance.UpdatedAt)
+	}
+}
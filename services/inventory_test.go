@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+	"github.com/sagarkarki99/arbitrator/dex"
+)
+
+var (
+	inventoryBase  = common.HexToAddress("0x0000000000000000000000000000000000000b01")
+	inventoryQuote = common.HexToAddress("0x0000000000000000000000000000000000000b02")
+)
+
+// testInventory makes WETH/USDC a known pair on a test network and returns an
+// inventory holding base WETH and quote USDC.
+func testInventory(t *testing.T, base, quote float64) *Inventory {
+	t.Helper()
+	previous := blockchain.ActiveChain
+	blockchain.ActiveChain = &blockchain.Network{ChainName: "INVENTORY", Network: blockchain.Mainnet}
+	dex.ChainConfigs["INVENTORY"] = &dex.NetworkConfig{Mainnet: map[dex.DexApp]map[string]*dex.PoolConfig{
+		dex.Uniswap: {"WETH/USDC": {
+			Token0:         "WETH",
+			Token1:         "USDC",
+			Token0Contract: inventoryBase.Hex(),
+			Token1Contract: inventoryQuote.Hex(),
+			Token0Decimals: 18,
+			Token1Decimals: 6,
+			Address:        "0x0000000000000000000000000000000000000a11",
+		}},
+	}}
+	t.Cleanup(func() {
+		blockchain.ActiveChain = previous
+		delete(dex.ChainConfigs, "INVENTORY")
+	})
+
+	return &Inventory{
+		tokens: map[common.Address]*TokenBalance{
+			inventoryBase:  {Token: inventoryBase, Symbol: "WETH", Decimals: 18, Balance: dex.ToTokenUnits(base, 18), Reserved: new(big.Int)},
+			inventoryQuote: {Token: inventoryQuote, Symbol: "USDC", Decimals: 6, Balance: dex.ToTokenUnits(quote, 6), Reserved: new(big.Int)},
+		},
+		native: new(big.Int),
+	}
+}
+
+func TestInventory_Reserve(t *testing.T) {
+	tests := []struct {
+		name          string
+		held          float64
+		base, quote   float64
+		expectedError string
+	}{
+		{"within balance", 0, 1, 1000, ""},
+		{"whole balance", 0, 2, 4000, ""},
+		{"too much base", 0, 2.5, 1000, "insufficient WETH"},
+		{"too much quote", 0, 1, 4000.5, "insufficient USDC"},
+		{"quote held by another trade", 3500, 1, 1000, "insufficient USDC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			inventory := testInventory(t, 2, 4000)
+			if tt.held > 0 {
+				if _, err := inventory.Reserve("WETH/USDC", 0, tt.held); err != nil {
+					t.Fatalf("Expected to hold %v USDC, got %v", tt.held, err)
+				}
+			}
+
+			// Act
+			_, err := inventory.Reserve("WETH/USDC", tt.base, tt.quote)
+
+			// Assert
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("Expected the reservation, got %v", err)
+				}
+				base, quote, _ := inventory.Available("WETH/USDC")
+				if base != 2-tt.base || quote != 4000-tt.held-tt.quote {
+					t.Errorf("Expected %v WETH and %v USDC available, got %v and %v", 2-tt.base, 4000-tt.held-tt.quote, base, quote)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.expectedError, err)
+			}
+			base, quote, _ := inventory.Available("WETH/USDC")
+			if base != 2 || quote != 4000-tt.held {
+				t.Errorf("Expected a failed reservation to hold nothing, got %v WETH and %v USDC available", base, quote)
+			}
+		})
+	}
+}
+
+func TestReservation_ReleaseAfterFailedTrade(t *testing.T) {
+	// Arrange
+	inventory := testInventory(t, 2, 4000)
+	reservation, err := inventory.Reserve("WETH/USDC", 1, 1000)
+	if err != nil {
+		t.Fatalf("Expected the reservation, got %v", err)
+	}
+
+	// Act
+	reservation.Release()
+	reservation.Release()
+
+	// Assert
+	base, quote, _ := inventory.Available("WETH/USDC")
+	if base != 2 || quote != 4000 {
+		t.Errorf("Expected 2 WETH and 4000 USDC available again, got %v and %v", base, quote)
+	}
+	for _, balance := range inventory.Balances() {
+		if balance.Reserved.Sign() != 0 {
+			t.Errorf("Expected nothing reserved of %s, got %s", balance.Symbol, balance.Reserved)
+		}
+	}
+}
+
+// unreachableClient is a client whose every request fails.
+func unreachableClient(t *testing.T) *blockchain.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+	rpcClient, err := ethclient.Dial(server.URL)
+	if err != nil {
+		t.Fatalf("Expected to dial the test server, got %v", err)
+	}
+	return &blockchain.Client{Client: rpcClient}
+}
+
+func TestInventory_TrackTradeReleasesRevertedTrade(t *testing.T) {
+	// Arrange
+	inventory := testInventory(t, 2, 4000)
+	inventory.cl = unreachableClient(t)
+	reverted := &types.Receipt{Status: types.ReceiptStatusFailed, BlockNumber: big.NewInt(10), BlockHash: common.HexToHash("0x0a")}
+	inventory.tracker = &TradeTracker{
+		cl:       &reorgingChain{head: 20, receipts: []*types.Receipt{reverted}},
+		interval: time.Millisecond,
+		pending:  make(map[common.Hash]time.Time),
+	}
+	reservation, err := inventory.Reserve("WETH/USDC", 1, 1000)
+	if err != nil {
+		t.Fatalf("Expected the reservation, got %v", err)
+	}
+
+	// Act
+	inventory.TrackTrade(context.Background(), reservation, "0x01")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err = inventory.WaitTrades(ctx)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected the trade to be followed, got %v", err)
+	}
+	base, quote, _ := inventory.Available("WETH/USDC")
+	if base != 2 || quote != 4000 {
+		t.Errorf("Expected the reverted trade to release 1 WETH and 1000 USDC, got %v and %v available", base, quote)
+	}
+}
+
+func TestInventory_ConcurrentReserves(t *testing.T) {
+	// Arrange
+	inventory := testInventory(t, 0, 10)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+
+	// Act
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := inventory.Reserve("WETH/USDC", 0, 1); err == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	if granted != 10 {
+		t.Errorf("Expected 10 reservations of 1 USDC out of 10, got %d", granted)
+	}
+	if _, quote, _ := inventory.Available("WETH/USDC"); quote != 0 {
+		t.Errorf("Expected no USDC available, got %v", quote)
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sagarkarki99/arbitrator/blockchain"
+)
+
+// tradeReceiptTimeout bounds how long a submitted trade is followed before
+// it is confirmed.
+const tradeReceiptTimeout = 2 * time.Minute
+
+// DefaultTradeConfirmations is how many blocks must be built on top of a
+// trade's block before it is final, unless TRADE_CONFIRMATIONS says otherwise.
+const DefaultTradeConfirmations = 3
+
+// TradeConfirmationsFromEnv reads TRADE_CONFIRMATIONS, the confirmation depth
+// at which trades are final. 0 treats a trade as final once it is mined.
+func TradeConfirmationsFromEnv() (uint64, error) {
+	raw := os.Getenv("TRADE_CONFIRMATIONS")
+	if raw == "" {
+		return DefaultTradeConfirmations, nil
+	}
+	confirmations, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("TRADE_CONFIRMATIONS: %q is not a block count", raw)
+	}
+	return confirmations, nil
+}
+
+// receiptReader reads receipts and the head block; *blockchain.Client
+// implements it.
+type receiptReader interface {
+	TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// TradeTracker follows submitted trade transactions until they are final:
+// mined and buried under the configured number of confirmations. A trade
+// whose block is reorged out before that is followed again until it is mined
+// anew.
+type TradeTracker struct {
+	cl            receiptReader
+	confirmations uint64
+	interval      time.Duration
+
+	mu      sync.Mutex
+	pending map[common.Hash]time.Time
+	// inFlight counts Track calls whose done has not returned yet.
+	inFlight sync.WaitGroup
+}
+
+func NewTradeTracker(cl *blockchain.Client, confirmations uint64) *TradeTracker {
+	interval := time.Second
+	if blockchain.ActiveChain != nil && blockchain.ActiveChain.BlockTime > 0 {
+		interval = blockchain.ActiveChain.BlockTime
+	}
+	return &TradeTracker{
+		cl:            cl,
+		confirmations: confirmations,
+		interval:      interval,
+		pending:       make(map[common.Hash]time.Time),
+	}
+}
+
+// Track waits in the background for every hash to be final and then calls
+// done, with an error when a trade was not final in time or reverted.
+func (t *TradeTracker) Track(hashes []common.Hash, done func(error)) {
+	t.mu.Lock()
+	for _, hash := range hashes {
+		t.pending[hash] = time.Now()
+	}
+	t.mu.Unlock()
+
+	t.inFlight.Add(1)
+	go func() {
+		defer t.inFlight.Done()
+		timeout := tradeReceiptTimeout + time.Duration(t.confirmations)*t.interval
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var errs []error
+		for _, hash := range hashes {
+			receipt, err := t.waitFinal(ctx, hash)
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("trade %s: %w", hash.Hex(), err))
+			case receipt.Status != types.ReceiptStatusSuccessful:
+				errs = append(errs, fmt.Errorf("trade %s reverted", hash.Hex()))
+			default:
+				slog.Info("Trade final", "hash", hash.Hex(), "block", receipt.BlockNumber, "confirmations", t.confirmations, "gasUsed", receipt.GasUsed)
+			}
+			t.mu.Lock()
+			delete(t.pending, hash)
+			t.mu.Unlock()
+		}
+		done(errors.Join(errs...))
+	}()
+}
+
+// Pending returns the number of trade transactions that are not final yet.
+func (t *TradeTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// Wait blocks until every tracked trade is final or failed and its done has
+// returned, or until ctx is cancelled.
+func (t *TradeTracker) Wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		t.inFlight.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d trade transactions still pending: %w", t.Pending(), ctx.Err())
+	}
+}
+
+// waitFinal waits for hash to be mined and confirmed, starting over whenever
+// the block it was mined in is reorged out.
+func (t *TradeTracker) waitFinal(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	for {
+		receipt, err := t.waitReceipt(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if t.confirmations == 0 {
+			return receipt, nil
+		}
+		slog.Info("Trade mined, waiting for confirmations", "hash", hash.Hex(), "block", receipt.BlockNumber, "confirmations", t.confirmations)
+		final, err := t.waitConfirmations(ctx, receipt)
+		if err != nil {
+			return nil, err
+		}
+		if final != nil {
+			return final, nil
+		}
+		slog.Warn("Trade block was reorged out, waiting for the trade to be mined again",
+			"hash", hash.Hex(), "block", receipt.BlockNumber, "blockHash", receipt.BlockHash.Hex())
+	}
+}
+
+// waitConfirmations waits until the chain is confirmations blocks past the
+// receipt's block and then re-reads the receipt. It returns nil when the
+// trade is no longer in that block.
+func (t *TradeTracker) waitConfirmations(ctx context.Context, receipt *types.Receipt) (*types.Receipt, error) {
+	target := new(big.Int).Add(receipt.BlockNumber, new(big.Int).SetUint64(t.confirmations)).Uint64()
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		head, err := t.cl.BlockNumber(ctx)
+		if err != nil {
+			slog.Warn("Failed to read head block, retrying", "hash", receipt.TxHash.Hex(), "error", err)
+		} else if head >= target {
+			current, err := t.cl.TransactionReceipt(ctx, receipt.TxHash)
+			switch {
+			case errors.Is(err, ethereum.NotFound):
+				return nil, nil
+			case err != nil:
+				slog.Warn("Failed to re-check trade receipt, retrying", "hash", receipt.TxHash.Hex(), "error", err)
+			case current.BlockHash != receipt.BlockHash:
+				return nil, nil
+			default:
+				return current, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("not confirmed: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *TradeTracker) waitReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := t.cl.TransactionReceipt(ctx, hash)
+		if err == nil {
+			return receipt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			slog.Warn("Failed to fetch trade receipt, retrying", "hash", hash.Hex(), "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no receipt: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// reorgingChain answers receipt lookups from a script, repeating the last
+// answer once the script is exhausted.
+type reorgingChain struct {
+	mu       sync.Mutex
+	head     uint64
+	receipts []*types.Receipt
+}
+
+func (c *reorgingChain) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	receipt := c.receipts[0]
+	if len(c.receipts) > 1 {
+		c.receipts = c.receipts[1:]
+	}
+	if receipt == nil {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+func (c *reorgingChain) BlockNumber(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.head++
+	return c.head, nil
+}
+
+func TestTradeTracker_RechecksReorgedTrades(t *testing.T) {
+	// Arrange
+	reorged := &types.Receipt{Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(10), BlockHash: common.HexToHash("0x0a")}
+	canonical := &types.Receipt{Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(11), BlockHash: common.HexToHash("0x0b")}
+	chain := &reorgingChain{head: 9, receipts: []*types.Receipt{nil, reorged, nil, canonical}}
+	tracker := &TradeTracker{cl: chain, confirmations: 3, interval: time.Millisecond, pending: make(map[common.Hash]time.Time)}
+	done := make(chan error, 1)
+
+	// Act
+	tracker.Track([]common.Hash{common.HexToHash("0x01")}, func(err error) { done <- err })
+
+	// Assert
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected the trade to be final, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the trade to be final")
+	}
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	if chain.head < 14 {
+		t.Errorf("Expected the trade to be confirmed 3 blocks past block 11, head is %d", chain.head)
+	}
+	if tracker.Pending() != 0 {
+		t.Errorf("Expected no pending trades, got %d", tracker.Pending())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tracker.Wait(ctx); err != nil {
+		t.Errorf("Expected Wait to return once the trade is final, got %v", err)
+	}
+}